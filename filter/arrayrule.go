@@ -0,0 +1,189 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "fmt"
+  "math"
+  "strconv"
+  "strings"
+)
+
+// arraySection marks an object of rules as an array rule. Its value maps selectors to rules.
+const arraySection = "$array"
+
+// isArrayRule determines if a rule is an array rule rather than an object of rules.
+func isArrayRule(rule interface{}) bool {
+  m,ok := rule.(map[string]interface{})
+  if ok {
+    _,ok = m[arraySection]
+  }
+  return ok
+}
+
+// arraySelector selects items of an array. It is either a single index or a slice of indices
+// from start up to but excluding end. Negative values count from the end of the array.
+type arraySelector struct {
+  start int
+  end int
+  slice bool
+  openStart bool
+  openEnd bool
+}
+
+// parseArraySelector parses "<index>" or "<start>:<end>", where start and end can be omitted.
+func parseArraySelector(selector string) (sel arraySelector, err error) {
+  parts := strings.Split(selector, ":")
+
+  switch len(parts) {
+  case 1:
+    sel.start,err = strconv.Atoi(parts[0])
+  case 2:
+    sel.slice = true
+    if sel.openStart = len(parts[0]) == 0; !sel.openStart {
+      if sel.start,err = strconv.Atoi(parts[0]); err != nil {
+        break
+      }
+    }
+    if sel.openEnd = len(parts[1]) == 0; !sel.openEnd {
+      sel.end,err = strconv.Atoi(parts[1])
+    }
+  default:
+    err = fmt.Errorf("too many ':'")
+  }
+
+  if err != nil {
+    err = fmt.Errorf("invalid array selector '%s', expected an index such as 0 or -1, a slice such as 1:3 or %s", selector, defaultRule)
+  }
+  return
+}
+
+// needsLength determines if the selector counts from the end of the array.
+func (sel arraySelector) needsLength() bool {
+  return (sel.start < 0 && !sel.openStart) || (sel.slice && sel.end < 0 && !sel.openEnd)
+}
+
+// match determines if the selector selects index in an array of length items and returns the
+// number of items it selects. Length is 0 when unknown, in which case selectors that count from
+// the end of the array never match.
+func (sel arraySelector) match(index int, length int) (bool, int) {
+  if length == 0 && sel.needsLength() {
+    return false,0
+  }
+
+  resolve := func (i int) int {
+    if i < 0 {
+      return length + i
+    }
+    return i
+  }
+
+  if !sel.slice {
+    return resolve(sel.start) == index,1
+  }
+
+  start,end := 0,math.MaxInt32
+  if !sel.openStart {
+    start = resolve(sel.start)
+  }
+  if !sel.openEnd {
+    end = resolve(sel.end)
+  } else if length > 0 {
+    end = length
+  }
+
+  return index >= start && index < end,end - start
+}
+
+// matchArrayRule returns the selector and rule of an array rule that apply to an array index.
+// Indices take precedence over slices and indices counting from the start over those counting from
+// the end. The narrowest slice takes precedence over wider ones and the "$default" rule applies to
+// items no other selector matches.
+func matchArrayRule(elem PathElement, selectors map[string]interface{}) (string, interface{}, bool) {
+  fromEnd,best,bestWidth := "","",0
+
+  for _,selector := range sortedKeys(selectors) {
+    if selector == defaultRule {
+      continue
+    }
+    sel,err := parseArraySelector(selector)
+    if err != nil {
+      continue
+    }
+    if ok,width := sel.match(elem.Index, elem.Len); !ok {
+      continue
+    } else if !sel.slice && sel.start >= 0 {
+      return selector,selectors[selector],true
+    } else if !sel.slice {
+      fromEnd = selector
+    } else if best == "" || width < bestWidth {
+      best,bestWidth = selector,width
+    }
+  }
+
+  if fromEnd != "" {
+    return fromEnd,selectors[fromEnd],true
+  } else if best != "" {
+    return best,selectors[best],true
+  } else if rule,ok := selectors[defaultRule]; ok {
+    return defaultRule,rule,true
+  }
+  return "",nil,false
+}
+
+// needsArrayLengths determines if any array rule in filters counts from the end of an array.
+func needsArrayLengths(filters interface{}) bool {
+  switch filters.(type) {
+  case map[string]interface{}:
+    for k,v := range filters.(map[string]interface{}) {
+      if selectors,ok := v.(map[string]interface{}); ok && k == arraySection {
+        for selector := range selectors {
+          if sel,err := parseArraySelector(selector); err == nil && sel.needsLength() {
+            return true
+          }
+        }
+      }
+      if needsArrayLengths(v) {
+        return true
+      }
+    }
+  case []interface{}:
+    for _,v := range filters.([]interface{}) {
+      if needsArrayLengths(v) {
+        return true
+      }
+    }
+  }
+  return false
+}
+
+func validateArrayRule(m map[string]interface{}, path Path, errs *ValidationErrors) {
+  fail := func (path Path, format string, args ...interface{}) {
+    *errs = append(*errs, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+  }
+
+  if len(m) > 1 {
+    fail(path, "an array rule cannot have other keys, got %s", strings.Join(sortedKeys(m), ", "))
+  }
+
+  path = path.Append(Key(arraySection))
+  selectors,ok := m[arraySection].(map[string]interface{})
+  if !ok {
+    fail(path, "expected an object of array selectors, got %s", jsonTypeName(m[arraySection]))
+    return
+  } else if len(selectors) == 0 {
+    fail(path, "array rule has no selectors and can never match")
+  }
+
+  for _,selector := range sortedKeys(selectors) {
+    if selector != defaultRule {
+      if _,err := parseArraySelector(selector); err != nil {
+        fail(path.Append(Key(selector)), "%s", err.Error())
+        continue
+      }
+    }
+    validateRule(selectors[selector], path.Append(Key(selector)), errs)
+  }
+}
@@ -0,0 +1,65 @@
+package filter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const arrayRuleJson = `{"items": ["a", "b", "c", "d", "e", "f"], "matrix": [["x", "y"], ["z"]], "pairs": ["p", "q"], "one": ["o"]}`
+
+func commandFilterRunner(command string, value string) (string, error) {
+	return command + "(" + value + ")",nil
+}
+
+func TestArrayRule_selectors(t *testing.T) {
+	expectedJson := `{"items":["first(a)","middle(b)","middle(c)","rest(d)","rest(e)","last(f)"],"matrix":[["x","corner(y)"],["z"]],"one":["o"],"pairs":["head(p)","any(q)"]}`
+	options := Options{FilterRunner: commandFilterRunner}
+
+	if value,err := FilterJsonFromTextWithOptions(arrayRuleJson, "./fixtures/array-rule-filter.json", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if b,_ := json.Marshal(value); string(b) != expectedJson {
+		t.Fatalf("Expected %v got %v", expectedJson, string(b))
+	}
+
+	// The byte filter has to count the items of each array to resolve negative indices.
+	expectedJson = `{"items":["first(a)","middle(b)","middle(c)","rest(d)","rest(e)","last(f)"],"matrix":[["x","corner(y)"],["z"]],"pairs":["head(p)","any(q)"],"one":["o"]}`
+	if data,err := FilterBytesWithOptions([]byte(arrayRuleJson), "./fixtures/array-rule-filter.json", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if string(data) != expectedJson {
+		t.Fatalf("Expected %v got %v", expectedJson, string(data))
+	}
+}
+
+func TestArrayRule_precedence(t *testing.T) {
+	selectors := map[string]interface{}{"-1": "last", "0": "first", "0:5": "wide", "0:2": "narrow", "$default": "rest"}
+
+	if selector,_,_ := matchArrayRule(arrayIndex(0, 1), selectors); selector != "0" {
+		t.Fatalf("Expected indices from the start to win got %v", selector)
+	}
+	if selector,_,_ := matchArrayRule(arrayIndex(1, 3), selectors); selector != "0:2" {
+		t.Fatalf("Expected the narrowest slice to win got %v", selector)
+	}
+	if selector,_,_ := matchArrayRule(Index(4), selectors); selector != "0:5" {
+		t.Fatalf("Expected the wide slice got %v", selector)
+	}
+	if selector,_,_ := matchArrayRule(Index(9), selectors); selector != "$default" {
+		t.Fatalf("Expected the default rule got %v", selector)
+	}
+}
+
+func TestArrayRule_validation(t *testing.T) {
+	filters := map[string]interface{}{
+		"a": map[string]interface{}{"$array": map[string]interface{}{"1:2:3": "x", "y": "x"}},
+		"b": map[string]interface{}{"$array": map[string]interface{}{"0": "x"}, "c": "x"},
+		"d": map[string]interface{}{"$array": map[string]interface{}{}},
+	}
+
+	errs,ok := ValidateFilters(filters).(ValidationErrors)
+	if !ok || len(errs) != 4 {
+		t.Fatalf("Expected 4 validation errors got %v", errs)
+	}
+	if !strings.Contains(errs[0].Error(), "invalid array selector '1:2:3'") {
+		t.Fatalf("Unexpected error :: %v", errs[0].Error())
+	}
+}
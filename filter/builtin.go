@@ -0,0 +1,93 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "fmt"
+  "strings"
+)
+
+// BuiltinPrefix marks a command as a built-in filter. Built-in filters are run in-process
+// regardless of the filter runner and have the form "builtin:<name>[:<arguments>]".
+const BuiltinPrefix = "builtin:"
+
+// builtin is a filter implemented in-process. Validate checks the arguments of the filter
+// when the filter is loaded and may be nil if the filter accepts any arguments. Inverse undoes
+// the filter when filtering in reverse and is nil if the filter cannot be undone. Cacheable
+// reports if results can be memoized and may be nil if the filter is always deterministic.
+type builtin struct {
+  run builtinFunc
+  validate func(args string) error
+  inverse builtinFunc
+  cacheable func(args string, options Options) bool
+}
+
+type builtinFunc func(args string, value string, options Options) (string, error)
+
+var builtins = map[string]builtin{
+  "detect": builtin{run: detectBuiltin, validate: detectBuiltinArgs},
+  "pseudonymize": builtin{run: pseudonymizeBuiltin, validate: pseudonymizeBuiltinArgs, inverse: originalBuiltin,
+    // A cached pseudonym would never be recorded in the mapping.
+    cacheable: func (args string, options Options) bool { return options.Mapping == nil }},
+  "encrypt": builtin{run: encryptBuiltin, validate: encryptionModeArgs, inverse: decryptBuiltin,
+    // GCM uses a random nonce, format-preserving modes are deterministic.
+    cacheable: func (args string, options Options) bool { return args == ModeFPE || args == ModeFPEAlnum }},
+  "decrypt": builtin{run: decryptBuiltin, validate: encryptionModeArgs, inverse: encryptBuiltin},
+  "fake": builtin{run: fakeBuiltin, validate: fakeBuiltinArgs,
+    cacheable: func (args string, options Options) bool { return len(options.Seed) > 0 }},
+}
+
+// IsBuiltin determines if a command refers to a built-in filter.
+func IsBuiltin(command string) bool {
+  return strings.HasPrefix(command, BuiltinPrefix)
+}
+
+func parseBuiltin(command string) (name string, args string) {
+  name = strings.TrimPrefix(command, BuiltinPrefix)
+  if i := strings.Index(name, ":"); i >= 0 {
+    name,args = name[:i],name[i + 1:]
+  }
+  return
+}
+
+func runBuiltin(command string, value string, options Options) (string, error) {
+  name,args := parseBuiltin(command)
+  if b,ok := builtins[name]; ok {
+    return b.run(args, value, options)
+  }
+  return "",fmt.Errorf("Unknown built-in filter '%s'", name)
+}
+
+// runInverse undoes a filter. The value is returned as-is when the command is not a built-in
+// filter that can be undone.
+func runInverse(command string, value string, options Options) (string, error) {
+  if !IsBuiltin(command) {
+    return value,nil
+  }
+
+  name,args := parseBuiltin(command)
+  if b,ok := builtins[name]; ok && b.inverse != nil {
+    return b.inverse(args, value, options)
+  }
+  return value,nil
+}
+
+func builtinCacheable(command string, options Options) bool {
+  name,args := parseBuiltin(command)
+  if b,ok := builtins[name]; ok && b.cacheable != nil {
+    return b.cacheable(args, options)
+  }
+  return true
+}
+
+func validateBuiltin(command string) error {
+  name,args := parseBuiltin(command)
+  if b,ok := builtins[name]; !ok {
+    return fmt.Errorf("unknown built-in filter '%s'", name)
+  } else if b.validate != nil {
+    return b.validate(args)
+  }
+  return nil
+}
@@ -0,0 +1,344 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "bytes"
+  "encoding/json"
+  "io"
+  "io/ioutil"
+  "unicode/utf8"
+)
+
+// FilterBytes filters JSON data held in a byte slice and returns the filtered JSON data. Unlike
+// FilterJsonFromText the data is never decoded into an interface{} value: only string values are
+// decoded, everything else is copied through as-is. The result is compact and object keys keep
+// their original order. Paths passed to a PathFilterRunner are reused and must be copied to be
+// retained. See FilterJsonFromText for details on the filter argument.
+func FilterBytes(data []byte, filter string) ([]byte, error) {
+  return FilterBytesWithOptions(data, filter, Options{})
+}
+
+// FilterBytesWithOptions filters JSON data held in a byte slice using the specified options.
+// See FilterBytes.
+func FilterBytesWithOptions(data []byte, filter string, options Options) ([]byte, error) {
+  f,err := Compile(filter, options)
+  if err != nil {
+    return nil,err
+  }
+
+  return f.Bytes(data)
+}
+
+// FilterTo reads JSON data from a reader, filters it and writes the filtered JSON data to a writer.
+// See FilterBytes.
+func FilterTo(reader io.Reader, writer io.Writer, filter string) error {
+  return FilterToWithOptions(reader, writer, filter, Options{})
+}
+
+// FilterToWithOptions reads JSON data from a reader, filters it using the specified options and
+// writes the filtered JSON data to a writer. See FilterBytes.
+func FilterToWithOptions(reader io.Reader, writer io.Writer, filter string, options Options) error {
+  data,err := ioutil.ReadAll(options.Limits.Reader(reader))
+  if err != nil {
+    return err
+  }
+
+  if data,err = FilterBytesWithOptions(data, filter, options); err == nil {
+    _,err = writer.Write(data)
+  }
+
+  return err
+}
+
+func filterBytes(data []byte, run *filterRun) ([]byte, error) {
+  if len(bytes.TrimSpace(data)) == 0 {
+    return []byte{},nil
+  }
+
+  // Validating up front lets the scanner assume well-formed JSON.
+  if !json.Valid(data) {
+    var v interface{}
+    return nil,json.Unmarshal(data, &v)
+  }
+
+  s := &byteScanner{in: data, out: make([]byte, 0, len(data)), path: make(Path, 0, 16), visit: run.visit, counts: run.filters.arrayLengths, maxDepth: run.options.Limits.Depth}
+  s.skipSpace()
+  if remove,err := s.value(); err != nil {
+    return nil,err
+  } else if remove {
+    s.out = append(s.out[:0], "null"...)
+  }
+
+  if _,err := run.finish(); err != nil {
+    return nil,err
+  }
+
+  return s.out,nil
+}
+
+// byteScanner copies well-formed JSON from in to out while visiting every string value.
+// Path is a stack that is only valid for the duration of each visit.
+type byteScanner struct {
+  in []byte
+  pos int
+  out []byte
+  path Path
+  visit visitorFunc
+  // counts is set when array lengths must be known, which requires scanning each array twice.
+  counts bool
+  // maxDepth is the depth limit, 0 when there is none.
+  maxDepth int
+}
+
+func (s *byteScanner) skipSpace() {
+  for s.pos < len(s.in) {
+    switch s.in[s.pos] {
+    case ' ', '\t', '\n', '\r': s.pos++
+    default: return
+    }
+  }
+}
+
+// value copies the value at the current position. Returns true when the visitor removed it,
+// in which case nothing was written.
+func (s *byteScanner) value() (bool, error) {
+  if c := s.in[s.pos]; (c == '{' || c == '[') && s.maxDepth > 0 && len(s.path) >= s.maxDepth {
+    return false,&LimitError{Limit: LimitDepth, Max: int64(s.maxDepth), Path: append(Path{}, s.path...)}
+  }
+
+  switch s.in[s.pos] {
+  case '{': return false,s.object()
+  case '[': return false,s.array()
+  case '"': return s.str()
+  }
+
+  start := s.pos
+  for s.pos < len(s.in) {
+    c := s.in[s.pos]
+    if c == ',' || c == '}' || c == ']' || c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+      break
+    }
+    s.pos++
+  }
+  s.out = append(s.out, s.in[start:s.pos]...)
+  return false,nil
+}
+
+func (s *byteScanner) object() error {
+  s.pos++
+  s.out = append(s.out, '{')
+  written := 0
+
+  for {
+    s.skipSpace()
+    if s.in[s.pos] == '}' {
+      break
+    } else if s.in[s.pos] == ',' {
+      s.pos++
+      s.skipSpace()
+    }
+
+    start := s.pos
+    end := s.stringEnd()
+    key := decodeJSONString(s.in[start:end])
+    s.skipSpace()
+    s.pos++ // ':'
+    s.skipSpace()
+
+    mark := len(s.out)
+    if written > 0 {
+      s.out = append(s.out, ',')
+    }
+    s.out = append(s.out, s.in[start:end]...)
+    s.out = append(s.out, ':')
+
+    s.path = append(s.path, Key(key))
+    remove,err := s.value()
+    s.path = s.path[:len(s.path) - 1]
+    if err != nil {
+      return err
+    } else if remove {
+      s.out = s.out[:mark]
+    } else {
+      written++
+    }
+  }
+
+  s.pos++
+  s.out = append(s.out, '}')
+  return nil
+}
+
+func (s *byteScanner) array() error {
+  length := 0
+  if s.counts {
+    length = s.countItems()
+  }
+
+  s.pos++
+  s.out = append(s.out, '[')
+  written := 0
+
+  for index := 0; ; index++ {
+    s.skipSpace()
+    if s.in[s.pos] == ']' {
+      break
+    } else if s.in[s.pos] == ',' {
+      s.pos++
+      s.skipSpace()
+    }
+
+    mark := len(s.out)
+    if written > 0 {
+      s.out = append(s.out, ',')
+    }
+
+    s.path = append(s.path, arrayIndex(index, length))
+    remove,err := s.value()
+    s.path = s.path[:len(s.path) - 1]
+    if err != nil {
+      return err
+    } else if remove {
+      s.out = s.out[:mark]
+    } else {
+      written++
+    }
+  }
+
+  s.pos++
+  s.out = append(s.out, ']')
+  return nil
+}
+
+func (s *byteScanner) str() (bool, error) {
+  start := s.pos
+  end := s.stringEnd()
+  raw := s.in[start:end]
+  value := decodeJSONString(raw)
+
+  result,err := s.visit(s.path, value)
+  if err != nil {
+    return false,err
+  } else if result == removed {
+    return true,nil
+  }
+
+  if str,ok := result.(string); ok && str == value {
+    s.out = append(s.out, raw...)
+  } else if ok {
+    s.out = appendJSONString(s.out, str)
+  } else if b,err := json.Marshal(result); err == nil {
+    s.out = append(s.out, b...)
+  } else {
+    return false,err
+  }
+
+  return false,nil
+}
+
+// countItems returns the number of items in the array starting at the current position
+// without advancing.
+func (s *byteScanner) countItems() int {
+  count,depth,empty := 0,0,true
+
+  for k := s.pos + 1; k < len(s.in); k++ {
+    switch s.in[k] {
+    case '"':
+      for k++; s.in[k] != '"'; k++ {
+        if s.in[k] == '\\' {
+          k++
+        }
+      }
+      empty = false
+    case '[', '{':
+      depth++
+      empty = false
+    case ']', '}':
+      if depth == 0 {
+        if empty {
+          return 0
+        }
+        return count + 1
+      }
+      depth--
+    case ',':
+      if depth == 0 {
+        count++
+      }
+    case ' ', '\t', '\n', '\r':
+    default:
+      empty = false
+    }
+  }
+
+  return count
+}
+
+// stringEnd advances past the string starting at the current position and returns its end.
+func (s *byteScanner) stringEnd() int {
+  s.pos++
+  for s.in[s.pos] != '"' {
+    if s.in[s.pos] == '\\' {
+      s.pos++
+    }
+    s.pos++
+  }
+  s.pos++
+  return s.pos
+}
+
+// decodeJSONString decodes a quoted JSON string, taking a fast path when it has no escapes.
+func decodeJSONString(raw []byte) string {
+  inner := raw[1:len(raw) - 1]
+  if bytes.IndexByte(inner, '\\') < 0 && utf8.Valid(inner) {
+    return string(inner)
+  }
+
+  var value string
+  json.Unmarshal(raw, &value)
+  return value
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends value to out as a quoted JSON string.
+func appendJSONString(out []byte, value string) []byte {
+  out = append(out, '"')
+
+  for k := 0; k < len(value); {
+    c := value[k]
+    if c < utf8.RuneSelf {
+      switch {
+      case c == '"' || c == '\\':
+        out = append(out, '\\', c)
+      case c == '\n':
+        out = append(out, '\\', 'n')
+      case c == '\r':
+        out = append(out, '\\', 'r')
+      case c == '\t':
+        out = append(out, '\\', 't')
+      case c < 0x20:
+        out = append(out, '\\', 'u', '0', '0', hexDigits[c >> 4], hexDigits[c & 0xf])
+      default:
+        out = append(out, c)
+      }
+      k++
+      continue
+    }
+
+    r,size := utf8.DecodeRuneInString(value[k:])
+    if r == utf8.RuneError && size == 1 {
+      out = append(out, `\ufffd`...)
+    } else if r == '\u2028' || r == '\u2029' {
+      out = append(out, '\\', 'u', '2', '0', '2', hexDigits[r & 0xf])
+    } else {
+      out = append(out, value[k:k + size]...)
+    }
+    k += size
+  }
+
+  return append(out, '"')
+}
@@ -0,0 +1,85 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func upperFilterRunner(command string, value string) (string, error) {
+	return strings.ToUpper(value),nil
+}
+
+func TestFilterBytes_copiesEverythingButFilteredStrings(t *testing.T) {
+	jsonText := `{ "b": "Keep é", "a": "tab\there", "n": 1.50, "z": [true, null, -2e10, {"a": "nested"}] }`
+	expectedJson := `{"b":"KEEP É","a":"TAB\tHERE","n":1.50,"z":[true,null,-2e10,{"a":"nested"}]}`
+	options := Options{FilterRunner: upperFilterRunner}
+
+	if data,err := FilterBytesWithOptions([]byte(jsonText), "./fixtures/object-filter.json", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if string(data) != expectedJson {
+		t.Fatalf("Expected %v got %v", expectedJson, string(data))
+	}
+}
+
+func TestFilterBytes_deletesValues(t *testing.T) {
+	expectedJson := `{"id":"1","name":"X","meta":{"source":"s"},"items":[{"sku":"k"},{"sku":"j"}]}`
+
+	if data,err := FilterBytesWithOptions([]byte(defaultActionJson), "./fixtures/allow-filter.json", defaultActionOptions(ActionDelete)); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if string(data) != expectedJson {
+		t.Fatalf("Expected %v got %v", expectedJson, string(data))
+	}
+}
+
+func TestFilterBytes_invalidJson(t *testing.T) {
+	if _,err := FilterBytes([]byte(`{"a": "b"`), "upper"); err == nil {
+		t.Fatalf("Expected an error for invalid JSON")
+	}
+}
+
+func TestFilterTo(t *testing.T) {
+	var buffer bytes.Buffer
+	options := Options{FilterRunner: upperFilterRunner}
+
+	if err := FilterToWithOptions(strings.NewReader(`["a", {"b": "c"}]`), &buffer, "upper", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if buffer.String() != `["A",{"b":"C"}]` {
+		t.Fatalf("Unexpected output :: %v", buffer.String())
+	}
+}
+
+func benchmarkJson() []byte {
+	items := []string{}
+	for k := 0; k < 200; k++ {
+		items = append(items, fmt.Sprintf(`{"id": %d, "a": "value %d", "b": "Other %d", "tags": ["x", "y"], "active": true}`, k, k, k))
+	}
+	return []byte("[" + strings.Join(items, ",") + "]")
+}
+
+func BenchmarkFilterJsonFromText(b *testing.B) {
+	data := benchmarkJson()
+	options := Options{FilterRunner: upperFilterRunner}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+
+	for k := 0; k < b.N; k++ {
+		if _,err := FilterJsonFromTextWithOptions(string(data), "upper", options); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFilterBytes(b *testing.B) {
+	data := benchmarkJson()
+	options := Options{FilterRunner: upperFilterRunner}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+
+	for k := 0; k < b.N; k++ {
+		if _,err := FilterBytesWithOptions(data, "upper", options); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
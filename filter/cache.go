@@ -0,0 +1,145 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "container/list"
+  "fmt"
+  "sync"
+)
+
+// Cache memoizes filter results keyed by command and value so that a value repeated throughout
+// JSON data is only filtered once per command. The path of the value is part of the key when
+// Options.PathFilterRunner is set, and so are the options that change how commands are run on the
+// command line: Trim, InputNewline and Sandbox. The least recently used result is evicted when the
+// cache is full. Set Options.Cache to use a cache. A Cache can be shared between documents and is
+// safe for concurrent use.
+//
+// The cache assumes that a command always produces the same result for the same value. Built-in
+// filters that are not deterministic are never cached. Use Exclude for commands that are not.
+// A filter runner, secret, seed or encryption key is not part of the key, so a Cache must not be
+// shared between Options that set them differently.
+type Cache struct {
+  mutex sync.Mutex
+  size int
+  entries map[cacheKey]*list.Element
+  order *list.List
+  excluded map[string]bool
+  stats CacheStats
+}
+
+// CacheStats counts how a cache was used.
+type CacheStats struct {
+  Hits int
+  Misses int
+  Evictions int
+  Len int
+}
+
+type cacheKey struct {
+  command string
+  value string
+  // path is set when the filter runner is given the path of the value.
+  path string
+  // options identifies the options that change the result of a command.
+  options string
+}
+
+// newCacheKey returns the key of the result of running command on the value at path.
+func newCacheKey(path Path, command string, value string, options Options) cacheKey {
+  key := cacheKey{command: command, value: value}
+  if !IsBuiltin(command) {
+    if options.PathFilterRunner != nil {
+      key.path = path.Pointer()
+    }
+    key.options = fmt.Sprintf("%s,%t", options.Trim, options.InputNewline)
+    if options.Sandbox != nil {
+      key.options += fmt.Sprintf(",%+v", *options.Sandbox)
+    }
+  }
+  return key
+}
+
+type cacheEntry struct {
+  key cacheKey
+  result string
+}
+
+// NewCache returns a cache holding at most size results.
+func NewCache(size int) *Cache {
+  return &Cache{
+    size: size,
+    entries: map[cacheKey]*list.Element{},
+    order: list.New(),
+    excluded: map[string]bool{},
+  }
+}
+
+// Exclude prevents the results of command from being cached. Use it for commands that do not
+// always produce the same result for the same value.
+func (c *Cache) Exclude(command string) {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+  c.excluded[command] = true
+}
+
+// Stats returns the number of hits, misses and evictions so far and the number of cached results.
+func (c *Cache) Stats() CacheStats {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+  stats := c.stats
+  stats.Len = c.order.Len()
+  return stats
+}
+
+func (c *Cache) get(key cacheKey) (string, bool) {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  if elem,ok := c.entries[key]; ok {
+    c.order.MoveToFront(elem)
+    c.stats.Hits++
+    return elem.Value.(*cacheEntry).result,true
+  }
+
+  c.stats.Misses++
+  return "",false
+}
+
+func (c *Cache) put(key cacheKey, result string) {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  if c.size <= 0 {
+    return
+  }
+
+  if elem,ok := c.entries[key]; ok {
+    elem.Value.(*cacheEntry).result = result
+    c.order.MoveToFront(elem)
+    return
+  }
+
+  c.entries[key] = c.order.PushFront(&cacheEntry{key, result})
+  for c.order.Len() > c.size {
+    oldest := c.order.Back()
+    c.order.Remove(oldest)
+    delete(c.entries, oldest.Value.(*cacheEntry).key)
+    c.stats.Evictions++
+  }
+}
+
+func (c *Cache) cacheable(command string, options Options) bool {
+  c.mutex.Lock()
+  excluded := c.excluded[command]
+  c.mutex.Unlock()
+
+  if excluded {
+    return false
+  } else if IsBuiltin(command) {
+    return builtinCacheable(command, options)
+  }
+  return true
+}
@@ -0,0 +1,94 @@
+package filter
+
+import (
+	"testing"
+	"strings"
+)
+
+func TestCache_memoizesRepeatedValues(t *testing.T) {
+	calls := 0
+	filterRunner := func(command string, value string) (string, error) {
+		calls++
+		return strings.ToUpper(value),nil
+	}
+	cache := NewCache(10)
+	options := Options{FilterRunner: filterRunner, Cache: cache}
+	jsonText := `{"a": ["active", "active", "closed", "active"], "b": "closed"}`
+
+	if _,err := FilterJsonFromTextWithOptions(jsonText, "upper", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+	if calls != 2 {
+		t.Fatalf("Expected 2 filter runs got %v", calls)
+	}
+	if stats := cache.Stats(); stats.Hits != 3 || stats.Misses != 2 || stats.Len != 2 {
+		t.Fatalf("Unexpected cache stats :: %+v", stats)
+	}
+
+	cache.Exclude("upper")
+	if _,err := FilterJsonFromTextWithOptions(jsonText, "upper", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+	if calls != 7 {
+		t.Fatalf("Expected excluded commands to always run got %v runs", calls)
+	}
+}
+
+func TestCache_evictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewCache(2)
+	cache.put(cacheKey{command: "c", value: "a"}, "A")
+	cache.put(cacheKey{command: "c", value: "b"}, "B")
+	cache.get(cacheKey{command: "c", value: "a"})
+	cache.put(cacheKey{command: "c", value: "d"}, "D")
+
+	if _,ok := cache.get(cacheKey{command: "c", value: "b"}); ok {
+		t.Fatalf("Expected the least recently used result to be evicted")
+	}
+	if result,ok := cache.get(cacheKey{command: "c", value: "a"}); !ok || result != "A" {
+		t.Fatalf("Expected the recently used result to be kept")
+	}
+	if stats := cache.Stats(); stats.Evictions != 1 || stats.Len != 2 {
+		t.Fatalf("Unexpected cache stats :: %+v", stats)
+	}
+}
+
+func TestCache_skipsNondeterministicBuiltins(t *testing.T) {
+	cache := NewCache(10)
+	options := Options{Cache: cache}
+
+	if cache.cacheable("builtin:fake:name", options) || cache.cacheable("builtin:encrypt", options) {
+		t.Fatalf("Expected non-deterministic built-in filters to bypass the cache")
+	}
+	options.Seed = []byte("seed")
+	if !cache.cacheable("builtin:fake:name", options) || !cache.cacheable("builtin:encrypt:fpe", options) {
+		t.Fatalf("Expected deterministic built-in filters to be cached")
+	}
+}
+
+func TestCache_keys(t *testing.T) {
+	calls := 0
+	options := Options{Cache: NewCache(10), PathFilterRunner: func(path Path, command string, value string) (string, error) {
+		calls++
+		return path.Pointer(),nil
+	}}
+
+	if value,err := FilterJsonFromTextWithOptions(`{"a": "x", "b": "x"}`, "f", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if m := value.(map[string]interface{}); m["a"] != "/a" || m["b"] != "/b" || calls != 2 {
+		t.Fatalf("Expected results of a path filter runner to be cached by path got %v", value)
+	}
+
+	options = Options{}
+	key := newCacheKey(Path{Key("a")}, "f", "x", options)
+	if key != newCacheKey(Path{Key("b")}, "f", "x", options) {
+		t.Fatalf("Expected the path to be left out of the key without a path filter runner")
+	}
+	options.Trim = TrimNone
+	if key == newCacheKey(Path{Key("a")}, "f", "x", options) {
+		t.Fatalf("Expected the trim policy to be part of the key")
+	}
+	options = Options{Sandbox: &Sandbox{Dir: "/tmp"}}
+	if key == newCacheKey(Path{Key("a")}, "f", "x", options) {
+		t.Fatalf("Expected the sandbox to be part of the key")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "bytes"
+  "encoding/json"
+)
+
+// Filter is a filter that was loaded and validated once so that it can be applied to any number
+// of documents. A Filter is safe for concurrent use unless its options have a Report, which must
+// not be shared by concurrent filters.
+type Filter struct {
+  filters *spec
+  options Options
+}
+
+// Compile loads and validates a filter with the specified options. See FilterJsonFromText for
+// details on the filter argument.
+func Compile(filter string, options Options) (*Filter, error) {
+  if len(options.Scan) > 0 {
+    if _,err := selectDetectors(options.Scan); err != nil {
+      return nil,err
+    }
+  }
+
+  filters,err := loadFilters(filter, options.Profile)
+  if err != nil {
+    return nil,err
+  }
+
+  return &Filter{filters: filters, options: options},nil
+}
+
+// Options returns the options the filter was compiled with.
+func (f *Filter) Options() Options {
+  return f.options
+}
+
+// Value filters an already decoded JSON value and returns the filtered value and a JSON Patch of
+// the modifications. See FilterJsonFromText.
+func (f *Filter) Value(value interface{}) (result interface{}, patch Patch, err error) {
+  result = value
+  if err = f.options.Limits.checkDepth(value, Path{}); err != nil {
+    return
+  }
+
+  run := f.newRun(value)
+  if result,err = traverse(value, run.visit); err == nil {
+    patch,err = run.finish()
+  }
+
+  return
+}
+
+// Bytes filters JSON data held in a byte slice. See FilterBytes. A filter written as a JSON Schema
+// needs the decoded document to resolve its commands, so the data is decoded once first.
+func (f *Filter) Bytes(data []byte) ([]byte, error) {
+  if err := f.options.Limits.checkInput(len(data)); err != nil {
+    return nil,err
+  }
+
+  var document interface{}
+  if f.filters.schema != nil && len(bytes.TrimSpace(data)) > 0 {
+    if err := json.Unmarshal(data, &document); err != nil {
+      return nil,err
+    }
+  }
+
+  return filterBytes(data, f.newRun(document))
+}
+
+// newRun starts filtering a document. The document is only used by filters written as a JSON
+// Schema.
+func (f *Filter) newRun(document interface{}) *filterRun {
+  return &filterRun{filters: f.filters.forDocument(document), options: f.options, replacements: Patch{}, matched: map[string]bool{}}
+}
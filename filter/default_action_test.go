@@ -0,0 +1,72 @@
+package filter
+
+import (
+	"testing"
+	"strings"
+	"encoding/json"
+)
+
+const defaultActionJson = `{"id": "1", "name": "x", "email": "a@b.c", "meta": {"source": "s"}, "items": [{"sku": "k", "note": "n"}, "loose", {"sku": "j"}]}`
+
+func defaultActionOptions(action Action) Options {
+	return Options{
+		FilterRunner: func(command string, value string) (string, error) {
+			return strings.ToUpper(value),nil
+		},
+		DefaultAction: action,
+	}
+}
+
+func TestDefaultAction_redact(t *testing.T) {
+	expectedJson := `{"email":"[REDACTED]","id":"1","items":[{"note":"[REDACTED]","sku":"k"},"[REDACTED]",{"sku":"j"}],"meta":{"source":"s"},"name":"X"}`
+
+	if value,err := FilterJsonFromTextWithOptions(defaultActionJson, "./fixtures/allow-filter.json", defaultActionOptions(ActionRedact)); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if b,_ := json.Marshal(value); string(b) != expectedJson {
+		t.Fatalf("Expected '%v' got '%v'", expectedJson, string(b))
+	}
+}
+
+func TestDefaultAction_deleteWithPatch(t *testing.T) {
+	expectedJson := `{"id":"1","items":[{"sku":"k"},{"sku":"j"}],"meta":{"source":"s"},"name":"X"}`
+	expectedPatch := `[{"op":"replace","path":"/name","value":"X"},{"op":"remove","path":"/items/1"},{"op":"remove","path":"/items/0/note"},{"op":"remove","path":"/email"}]`
+
+	if value,patch,err := PatchJsonFromTextWithOptions(defaultActionJson, "./fixtures/allow-filter.json", defaultActionOptions(ActionDelete)); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if b,_ := json.Marshal(value); string(b) != expectedJson {
+		t.Fatalf("Expected '%v' got '%v'", expectedJson, string(b))
+	} else if b,_ := json.Marshal(patch); string(b) != expectedPatch {
+		t.Fatalf("Expected patch '%v' got '%v'", expectedPatch, string(b))
+	}
+}
+
+func TestDefaultAction_error(t *testing.T) {
+	_,err := FilterJsonFromTextWithOptions(defaultActionJson, "./fixtures/allow-filter.json", defaultActionOptions(ActionError))
+	if unmatched,ok := err.(*UnmatchedValueError); !ok {
+		t.Fatalf("Expected an UnmatchedValueError got %v", err)
+	} else if unmatched.Path.JSONPath() != "$.email" {
+		t.Fatalf("Unexpected path :: %v", unmatched.Path)
+	}
+}
+
+func TestDefaultAction_reportCountsAllowed(t *testing.T) {
+	options := defaultActionOptions(ActionPass)
+	options.Report = NewReport()
+
+	if _,err := FilterJsonFromTextWithOptions(defaultActionJson, "./fixtures/allow-filter.json", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+
+	if unmatched := strings.Join(options.Report.Unmatched(), ","); unmatched != "$.email,$.items[*],$.items[*].note" {
+		t.Fatalf("Unexpected unmatched paths :: %v", unmatched)
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	if action,err := ParseAction(""); err != nil || action != ActionPass {
+		t.Fatalf("Expected the empty string to parse as pass")
+	}
+	if _,err := ParseAction("drop"); err == nil {
+		t.Fatalf("Expected an error for an unknown action")
+	}
+}
@@ -0,0 +1,46 @@
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDescent_matchesAtAnyDepth(t *testing.T) {
+	jsonText := `{"customer": {"address": {"city": "c1", "street": "s1"}, "password": "p1"}, "orders": [{"ship": {"address": {"city": "c2"}}}], "password": "p0", "note": "n"}`
+	expectedJson := `{"customer":{"address":{"city":"anchored(c1)","street":"street(s1)"},"password":"secret(p1)"},"note":"n","orders":[{"ship":{"address":{"city":"city(c2)"}}}],"password":"secret(p0)"}`
+	options := Options{FilterRunner: commandFilterRunner}
+
+	if value,err := FilterJsonFromTextWithOptions(jsonText, "./fixtures/descent-filter.json", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if b,_ := json.Marshal(value); string(b) != expectedJson {
+		t.Fatalf("Expected %v got %v", expectedJson, string(b))
+	}
+}
+
+func TestDescent_precedence(t *testing.T) {
+	filters := map[string]interface{}{
+		"$default": "fallback",
+		"..a": map[string]interface{}{"b": map[string]interface{}{"c": "outer"}},
+		"..b": map[string]interface{}{"c": "nearest"},
+		"x": map[string]interface{}{"..b": map[string]interface{}{"c": "scoped"}},
+	}
+	tests := []struct {
+		path Path
+		command string
+	}{
+		{Path{Key("a"), Key("b"), Key("c")}, "nearest"},
+		{Path{Key("a"), Key("b"), Key("d")}, "fallback"},
+		{Path{Key("x"), Key("y"), Key("b"), Key("c")}, "scoped"},
+		{Path{Key("y"), Key("b"), Key("c")}, "nearest"},
+	}
+
+	for _,test := range tests {
+		if command,_,found := getFilterCommand(test.path, filters); !found || command != test.command {
+			t.Fatalf("Expected %v at %v got %v", test.command, test.path, command)
+		}
+	}
+
+	if err := ValidateFilters(map[string]interface{}{"a": map[string]interface{}{"..": "x"}}); err == nil {
+		t.Fatalf("Expected an error for a descent rule without a key")
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "fmt"
+  "math"
+  "math/big"
+  "net"
+  "regexp"
+  "strings"
+)
+
+// detector finds a kind of secret or personal information within a string. Valid, when set,
+// rejects pattern matches that fail a checksum or are otherwise not the real thing.
+type detector struct {
+  name string
+  pattern *regexp.Regexp
+  valid func(match string) bool
+}
+
+// detectors are applied in order. Detectors for the most specific formats come first so that,
+// for instance, the digits of an IBAN are not masked as a phone number.
+var detectors = []detector{
+  {"jwt", regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`), nil},
+  {"aws-key", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b|(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+]{40}`), nil},
+  {"email", regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), nil},
+  {"iban", regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`), validIBAN},
+  {"credit-card", regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`), validLuhn},
+  {"ipv6", regexp.MustCompile(`(?i)(?:\b[0-9a-f]{1,4}|\B)(?::[0-9a-f]{0,4}){2,7}(?:\b|\B)`), validIPv6},
+  {"ipv4", regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`), nil},
+  {"phone", regexp.MustCompile(`(?:\+\d{1,3}[ .\-]?)?(?:\(\d{1,4}\)[ .\-]?|\b\d{3}[ .\-])\d{3}[ .\-]\d{4}\b|\+\d{8,15}\b`), validPhone},
+  {"entropy", regexp.MustCompile(`[A-Za-z0-9+/=_\-]{20,}`), validHighEntropy},
+}
+
+// Detectors returns the names of every built-in detector in the order they are applied.
+func Detectors() []string {
+  names := make([]string, len(detectors))
+  for k,d := range detectors {
+    names[k] = d.name
+  }
+  return names
+}
+
+// Mask replaces every substring of value found by the named detectors with "[REDACTED:<detector>]".
+// The name "all", or no names at all, selects every detector. Returns an error if a name is unknown.
+func Mask(value string, names []string) (string, error) {
+  selected,err := selectDetectors(names)
+  if err != nil {
+    return "",err
+  }
+
+  for _,d := range selected {
+    d := d
+    value = d.pattern.ReplaceAllStringFunc(value, func (match string) string {
+      if d.valid == nil || d.valid(match) {
+        return "[REDACTED:" + d.name + "]"
+      }
+      return match
+    })
+  }
+
+  return value,nil
+}
+
+func selectDetectors(names []string) ([]detector, error) {
+  wanted := map[string]bool{}
+  for _,name := range names {
+    if name = strings.TrimSpace(name); name == "all" {
+      return detectors,nil
+    } else if name != "" {
+      wanted[name] = true
+    }
+  }
+  if len(wanted) == 0 {
+    return detectors,nil
+  }
+
+  selected := []detector{}
+  for _,d := range detectors {
+    if wanted[d.name] {
+      selected = append(selected, d)
+      delete(wanted, d.name)
+    }
+  }
+  for name := range wanted {
+    return nil,fmt.Errorf("Unknown detector '%s', expected one of %s", name, strings.Join(Detectors(), ", "))
+  }
+
+  return selected,nil
+}
+
+// detectBuiltin implements "builtin:detect[:<detector>,...]".
+func detectBuiltin(args string, value string, options Options) (string, error) {
+  return Mask(value, strings.Split(args, ","))
+}
+
+func detectBuiltinArgs(args string) (err error) {
+  _,err = selectDetectors(strings.Split(args, ","))
+  return
+}
+
+func digitsOf(s string) []int {
+  digits := []int{}
+  for _,r := range s {
+    if r >= '0' && r <= '9' {
+      digits = append(digits, int(r - '0'))
+    }
+  }
+  return digits
+}
+
+func validLuhn(match string) bool {
+  digits := digitsOf(match)
+  if len(digits) < 13 || len(digits) > 19 {
+    return false
+  }
+
+  sum := 0
+  for k := range digits {
+    d := digits[len(digits) - 1 - k]
+    if k % 2 == 1 {
+      if d *= 2; d > 9 {
+        d -= 9
+      }
+    }
+    sum += d
+  }
+
+  return sum % 10 == 0
+}
+
+func validIBAN(match string) bool {
+  iban := strings.Replace(match, " ", "", -1)
+  if len(iban) < 15 || len(iban) > 34 {
+    return false
+  }
+
+  // Move the country code and check digits to the end and convert letters to numbers.
+  var numeric strings.Builder
+  for _,r := range iban[4:] + iban[:4] {
+    if r >= 'A' && r <= 'Z' {
+      numeric.WriteString(fmt.Sprintf("%d", r - 'A' + 10))
+    } else {
+      numeric.WriteRune(r)
+    }
+  }
+
+  n,ok := new(big.Int).SetString(numeric.String(), 10)
+  return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// validIPv6 accepts addresses with at least one digit, so identifiers such as "Add::Bad" that
+// happen to be made of hex letters are left alone.
+func validIPv6(match string) bool {
+  return strings.Count(match, ":") >= 2 && strings.ContainsAny(match, "0123456789") && net.ParseIP(match) != nil
+}
+
+func validPhone(match string) bool {
+  digits := len(digitsOf(match))
+  return digits >= 7 && digits <= 15
+}
+
+// Hex tokens carry at most four bits of Shannon entropy per character, so they need a lower
+// threshold than tokens drawn from the larger base64 alphabet.
+const (
+  hexEntropyThreshold = 3.0
+  base64EntropyThreshold = 4.0
+)
+
+// validHighEntropy accepts tokens that mix letters and digits and carry enough Shannon entropy
+// per character for their alphabet, which is typical of generated keys and tokens.
+func validHighEntropy(match string) bool {
+  if !strings.ContainsAny(match, "0123456789") || strings.IndexFunc(match, isLetter) < 0 {
+    return false
+  }
+
+  counts := map[rune]float64{}
+  for _,r := range match {
+    counts[r]++
+  }
+
+  entropy := 0.0
+  length := float64(len(match))
+  for _,c := range counts {
+    p := c / length
+    entropy -= p * math.Log2(p)
+  }
+
+  if strings.Trim(match, "0123456789abcdefABCDEF") == "" {
+    return entropy >= hexEntropyThreshold
+  }
+  return entropy >= base64EntropyThreshold
+}
+
+func isLetter(r rune) bool {
+  return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
@@ -0,0 +1,271 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "crypto/aes"
+  "crypto/cipher"
+  "crypto/rand"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/binary"
+  "errors"
+  "fmt"
+  "io"
+  "math/big"
+  "strings"
+)
+
+// Encryption modes. ModeGCM produces authenticated, URL-safe base64 ciphertext with a random nonce.
+// ModeFPE and ModeFPEAlnum are FF1 format-preserving modes that encrypt the digits, or the letters
+// and digits, of a value in place and keep every other character, so the ciphertext has the
+// same length and shape as the value. FPE modes are deterministic.
+const (
+  ModeGCM = "gcm"
+  ModeFPE = "fpe"
+  ModeFPEAlnum = "fpe-alnum"
+)
+
+const (
+  digitsAlphabet = "0123456789"
+  alnumAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+var errMissingKey = errors.New("An encryption key is required, set Options.EncryptionKey")
+
+// Encrypt encrypts value with key using the specified mode. An empty mode is ModeGCM. The key can
+// be any length, it is hashed with SHA-256 into an AES-256 key.
+func Encrypt(value string, mode string, key []byte) (string, error) {
+  block,err := newBlockCipher(key)
+  if err != nil {
+    return "",err
+  }
+
+  switch mode {
+  case "", ModeGCM:
+    var gcm cipher.AEAD
+    if gcm,err = cipher.NewGCM(block); err != nil {
+      return "",err
+    }
+    nonce := make([]byte, gcm.NonceSize())
+    if _,err = io.ReadFull(rand.Reader, nonce); err != nil {
+      return "",err
+    }
+    return base64.RawURLEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(value), nil)),nil
+  case ModeFPE: return ff1Transform(block, digitsAlphabet, value, true)
+  case ModeFPEAlnum: return ff1Transform(block, alnumAlphabet, value, true)
+  }
+
+  return "",fmt.Errorf("Unknown encryption mode '%s'", mode)
+}
+
+// Decrypt reverses Encrypt given the same mode and key.
+func Decrypt(value string, mode string, key []byte) (string, error) {
+  block,err := newBlockCipher(key)
+  if err != nil {
+    return "",err
+  }
+
+  switch mode {
+  case "", ModeGCM:
+    var (
+      gcm cipher.AEAD
+      data []byte
+      plain []byte
+    )
+    if gcm,err = cipher.NewGCM(block); err != nil {
+      return "",err
+    }
+    if data,err = base64.RawURLEncoding.DecodeString(value); err != nil {
+      return "",err
+    }
+    if len(data) < gcm.NonceSize() {
+      return "",errors.New("Ciphertext is too short")
+    }
+    if plain,err = gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil); err != nil {
+      return "",err
+    }
+    return string(plain),nil
+  case ModeFPE: return ff1Transform(block, digitsAlphabet, value, false)
+  case ModeFPEAlnum: return ff1Transform(block, alnumAlphabet, value, false)
+  }
+
+  return "",fmt.Errorf("Unknown encryption mode '%s'", mode)
+}
+
+func newBlockCipher(key []byte) (cipher.Block, error) {
+  if len(key) == 0 {
+    return nil,errMissingKey
+  }
+  sum := sha256.Sum256(key)
+  return aes.NewCipher(sum[:])
+}
+
+// encryptBuiltin implements "builtin:encrypt[:<mode>]".
+func encryptBuiltin(args string, value string, options Options) (string, error) {
+  return Encrypt(value, args, options.EncryptionKey)
+}
+
+// decryptBuiltin implements "builtin:decrypt[:<mode>]".
+func decryptBuiltin(args string, value string, options Options) (string, error) {
+  return Decrypt(value, args, options.EncryptionKey)
+}
+
+func encryptionModeArgs(args string) error {
+  switch args {
+  case "", ModeGCM, ModeFPE, ModeFPEAlnum: return nil
+  }
+  return fmt.Errorf("unknown encryption mode '%s'", args)
+}
+
+// ff1Transform encrypts or decrypts the characters of value found in alphabet with FF1,
+// leaving every other character in place.
+func ff1Transform(block cipher.Block, alphabet string, value string, encrypt bool) (string, error) {
+  runes := []rune(value)
+  positions := []int{}
+  numerals := []int{}
+
+  for k,r := range runes {
+    if i := strings.IndexRune(alphabet, r); i >= 0 {
+      positions = append(positions, k)
+      numerals = append(numerals, i)
+    }
+  }
+
+  radix := len(alphabet)
+  // FF1 requires radix^n >= 1,000,000 for the domain to be large enough.
+  if new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(len(numerals))), nil).Cmp(big.NewInt(1000000)) < 0 {
+    return "",fmt.Errorf("Value has too few characters to encrypt in a format-preserving mode")
+  }
+
+  var result []int
+  if encrypt {
+    result = ff1Encrypt(block, radix, nil, numerals)
+  } else {
+    result = ff1Decrypt(block, radix, nil, numerals)
+  }
+
+  for k,pos := range positions {
+    runes[pos] = rune(alphabet[result[k]])
+  }
+
+  return string(runes),nil
+}
+
+// ff1Encrypt implements the FF1 encryption algorithm of NIST SP 800-38G for numerals in radix.
+func ff1Encrypt(block cipher.Block, radix int, tweak []byte, x []int) []int {
+  n := len(x)
+  u := n / 2
+  a,b := x[:u],x[u:]
+  p,blen,d := ff1Setup(radix, len(tweak), n, u)
+
+  for i := 0; i < 10; i++ {
+    m := u
+    if i % 2 == 1 {
+      m = n - u
+    }
+    y := ff1Round(block, p, tweak, i, numeralsToInt(b, radix), blen, d)
+    mod := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(m)), nil)
+    c := new(big.Int).Add(numeralsToInt(a, radix), y)
+    c.Mod(c, mod)
+    a,b = b,intToNumerals(c, radix, m)
+  }
+
+  return append(append([]int{}, a...), b...)
+}
+
+// ff1Decrypt implements the FF1 decryption algorithm of NIST SP 800-38G for numerals in radix.
+func ff1Decrypt(block cipher.Block, radix int, tweak []byte, x []int) []int {
+  n := len(x)
+  u := n / 2
+  a,b := x[:u],x[u:]
+  p,blen,d := ff1Setup(radix, len(tweak), n, u)
+
+  for i := 9; i >= 0; i-- {
+    m := u
+    if i % 2 == 1 {
+      m = n - u
+    }
+    y := ff1Round(block, p, tweak, i, numeralsToInt(a, radix), blen, d)
+    mod := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(m)), nil)
+    c := new(big.Int).Sub(numeralsToInt(b, radix), y)
+    c.Mod(c, mod)
+    a,b = intToNumerals(c, radix, m),a
+  }
+
+  return append(append([]int{}, a...), b...)
+}
+
+func ff1Setup(radix int, t int, n int, u int) (p []byte, b int, d int) {
+  v := n - u
+  // b = ceil(ceil(v * log2(radix)) / 8), computed exactly as the byte length of radix^v - 1.
+  max := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(v)), nil)
+  max.Sub(max, big.NewInt(1))
+  b = (max.BitLen() + 7) / 8
+  d = 4 * ((b + 3) / 4) + 4
+
+  p = []byte{1, 2, 1, byte(radix >> 16), byte(radix >> 8), byte(radix), 10, byte(u % 256), 0, 0, 0, 0, 0, 0, 0, 0}
+  binary.BigEndian.PutUint32(p[8:], uint32(n))
+  binary.BigEndian.PutUint32(p[12:], uint32(t))
+  return
+}
+
+func ff1Round(block cipher.Block, p []byte, tweak []byte, i int, num *big.Int, b int, d int) *big.Int {
+  q := append([]byte{}, tweak...)
+  q = append(q, make([]byte, mod(-len(tweak) - b - 1, 16))...)
+  q = append(q, byte(i))
+  numBytes := num.Bytes()
+  q = append(q, make([]byte, b - len(numBytes))...)
+  q = append(q, numBytes...)
+
+  // R = PRF(P || Q), CBC-MAC with a zero IV.
+  r := make([]byte, 16)
+  data := append(append([]byte{}, p...), q...)
+  for k := 0; k < len(data); k += 16 {
+    for j := 0; j < 16; j++ {
+      r[j] ^= data[k + j]
+    }
+    block.Encrypt(r, r)
+  }
+
+  s := append([]byte{}, r...)
+  for j := 1; len(s) < d; j++ {
+    x := make([]byte, 16)
+    binary.BigEndian.PutUint64(x[8:], uint64(j))
+    for k := range x {
+      x[k] ^= r[k]
+    }
+    block.Encrypt(x, x)
+    s = append(s, x...)
+  }
+
+  return new(big.Int).SetBytes(s[:d])
+}
+
+func mod(a int, m int) int {
+  return ((a % m) + m) % m
+}
+
+func numeralsToInt(x []int, radix int) *big.Int {
+  n := new(big.Int)
+  r := big.NewInt(int64(radix))
+  for _,v := range x {
+    n.Mul(n, r)
+    n.Add(n, big.NewInt(int64(v)))
+  }
+  return n
+}
+
+func intToNumerals(n *big.Int, radix int, m int) []int {
+  x := make([]int, m)
+  r := big.NewInt(int64(radix))
+  n = new(big.Int).Set(n)
+  rem := new(big.Int)
+  for k := m - 1; k >= 0; k-- {
+    n.DivMod(n, r, rem)
+    x[k] = int(rem.Int64())
+  }
+  return x
+}
@@ -0,0 +1,106 @@
+package filter
+
+import (
+	"testing"
+	"crypto/aes"
+	"encoding/hex"
+	"encoding/json"
+)
+
+func TestFF1_nistSamples(t *testing.T) {
+	key,_ := hex.DecodeString("2B7E151628AED2A6ABF7158809CF4F3C")
+	block,_ := aes.NewCipher(key)
+	cases := []struct {
+		tweak string
+		plain []int
+		cipher []int
+	}{
+		{"", []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, []int{2, 4, 3, 3, 4, 7, 7, 4, 8, 4}},
+		{"39383736353433323130", []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, []int{6, 1, 2, 4, 2, 0, 0, 7, 7, 3}},
+	}
+
+	for _,c := range cases {
+		tweak,_ := hex.DecodeString(c.tweak)
+		if got := ff1Encrypt(block, 10, tweak, c.plain); !equalNumerals(got, c.cipher) {
+			t.Fatalf("Expected FF1 ciphertext %v got %v", c.cipher, got)
+		}
+		if got := ff1Decrypt(block, 10, tweak, c.cipher); !equalNumerals(got, c.plain) {
+			t.Fatalf("Expected FF1 plaintext %v got %v", c.plain, got)
+		}
+	}
+}
+
+func TestEncrypt_roundTrip(t *testing.T) {
+	key := []byte("key material")
+	cases := []struct {
+		value string
+		mode string
+	}{
+		{"hello world", ModeGCM},
+		{"4111-1111-1111-1111", ModeFPE},
+		{"AB12-cd34-EF", ModeFPEAlnum},
+	}
+
+	for _,c := range cases {
+		encrypted,err := Encrypt(c.value, c.mode, key)
+		if err != nil {
+			t.Fatalf("Expected no error :: %v", err.Error())
+		} else if encrypted == c.value {
+			t.Fatalf("Expected '%v' to be encrypted", c.value)
+		}
+		if c.mode != ModeGCM && len(encrypted) != len(c.value) {
+			t.Fatalf("Expected format-preserving ciphertext '%v' to keep the length of '%v'", encrypted, c.value)
+		}
+		if decrypted,err := Decrypt(encrypted, c.mode, key); err != nil {
+			t.Fatalf("Expected no error :: %v", err.Error())
+		} else if decrypted != c.value {
+			t.Fatalf("Expected '%v' to decrypt to '%v' got '%v'", encrypted, c.value, decrypted)
+		}
+	}
+
+	if _,err := Decrypt("bm9wZQ", ModeGCM, key); err == nil {
+		t.Fatalf("Expected an error for invalid ciphertext")
+	}
+	if _,err := Encrypt("123", ModeFPE, key); err == nil {
+		t.Fatalf("Expected an error for a value too short to encrypt")
+	}
+	if _,err := Encrypt("x", ModeGCM, nil); err == nil {
+		t.Fatalf("Expected an error without a key")
+	}
+}
+
+func TestReverse_encryptAndPseudonymize(t *testing.T) {
+	filters := `./fixtures/encrypt-filter.json`
+	jsonText := `{"card": "4111 1111 1111 1111", "note": "secret", "email": "x@y.io", "other": "left"}`
+	options := Options{EncryptionKey: []byte("k"), Secret: []byte("s"), Mapping: NewMapping()}
+
+	encrypted,err := FilterJsonFromTextWithOptions(jsonText, filters, options)
+	if err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+	b,_ := json.Marshal(encrypted)
+
+	options.Reverse = true
+	if decrypted,err := FilterJsonFromTextWithOptions(string(b), filters, options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if b,_ := json.Marshal(decrypted); string(b) != `{"card":"4111 1111 1111 1111","email":"x@y.io","note":"secret","other":"left"}` {
+		t.Fatalf("Unexpected reversed JSON :: %v", string(b))
+	}
+
+	options.Mapping = nil
+	if _,err := FilterJsonFromTextWithOptions(string(b), filters, options); err == nil {
+		t.Fatalf("Expected an error reversing pseudonyms without a mapping")
+	}
+}
+
+func equalNumerals(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "crypto/rand"
+  "fmt"
+  "sort"
+  "strings"
+  "time"
+)
+
+var (
+  fakeFirstNames = []string{"Ada", "Alan", "Amara", "Ben", "Carmen", "Chen", "Dara", "Elena", "Farid", "Grace", "Hiro", "Ines", "Jonas", "Kofi", "Lena", "Mateo", "Nadia", "Omar", "Priya", "Quinn", "Rosa", "Sami", "Tara", "Umar", "Vera", "Wen", "Yusuf", "Zoe"}
+  fakeLastNames = []string{"Abbott", "Bauer", "Castillo", "Dubois", "Eriksen", "Fischer", "Garcia", "Haddad", "Ito", "Jensen", "Kowalski", "Larsen", "Moreau", "Nakamura", "Okafor", "Petrov", "Quintero", "Rossi", "Silva", "Tanaka", "Ueda", "Varga", "Weber", "Xu", "Yilmaz", "Zimmermann"}
+  fakeStreets = []string{"Maple", "Oak", "Cedar", "Pine", "Elm", "Willow", "Birch", "Harbor", "Hill", "Lake", "Meadow", "River", "Park", "Mill", "Spring"}
+  fakeStreetTypes = []string{"Street", "Avenue", "Road", "Lane", "Drive", "Way", "Court", "Place"}
+  fakeCities = []string{"Springfield", "Riverton", "Fairview", "Lakeside", "Greenville", "Milton", "Ashford", "Brookfield", "Clayton", "Dover", "Easton", "Franklin"}
+  fakeCompanySuffixes = []string{"Holdings", "Industries", "Labs", "Partners", "Systems", "Group", "Logistics", "Analytics", "Works", "Ventures"}
+  fakeDomains = []string{"example.com", "example.net", "example.org"}
+  fakeLorem = strings.Fields("lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor incididunt ut labore et dolore magna aliqua enim ad minim veniam quis nostrud exercitation ullamco laboris nisi aliquip ex ea commodo consequat")
+  fakeDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02", "01/02/2006", "02.01.2006"}
+)
+
+// fakers generate a fake value from a stream. Value is the original value, which some fakers
+// use to keep its shape, such as the number of words or the date layout.
+var fakers = map[string]func(s *keyStream, value string) string{
+  "name": func (s *keyStream, value string) string {
+    return pick(s, fakeFirstNames) + " " + pick(s, fakeLastNames)
+  },
+  "email": func (s *keyStream, value string) string {
+    return strings.ToLower(pick(s, fakeFirstNames) + "." + pick(s, fakeLastNames)) + "@" + pick(s, fakeDomains)
+  },
+  "address": func (s *keyStream, value string) string {
+    return fmt.Sprintf("%d %s %s, %s", 1 + s.uint64() % 9999, pick(s, fakeStreets), pick(s, fakeStreetTypes), pick(s, fakeCities))
+  },
+  "company": func (s *keyStream, value string) string {
+    return pick(s, fakeLastNames) + " " + pick(s, fakeCompanySuffixes)
+  },
+  "lorem": func (s *keyStream, value string) string {
+    count := len(strings.Fields(value))
+    if count == 0 {
+      count = 1
+    }
+    words := make([]string, count)
+    for k := range words {
+      words[k] = pick(s, fakeLorem)
+    }
+    return strings.Join(words, " ")
+  },
+  "date": func (s *keyStream, value string) string {
+    layout := "2006-01-02"
+    for _,l := range fakeDateLayouts {
+      if _,err := time.Parse(l, value); err == nil {
+        layout = l
+        break
+      }
+    }
+    // Any second between 1970 and 2030.
+    seconds := int64(s.uint64() % uint64(60 * 365.25 * 24 * 60 * 60))
+    return time.Unix(seconds, 0).UTC().Format(layout)
+  },
+  "uuid": func (s *keyStream, value string) string {
+    return s.uuid()
+  },
+}
+
+// Fake returns a fake value of the specified kind. Kinds are name, email, address, company, lorem,
+// date and uuid. When seed is set the same seed, kind and value always produce the same fake value,
+// otherwise the fake value is random.
+func Fake(kind string, value string, seed []byte) (string, error) {
+  faker,ok := fakers[kind]
+  if !ok {
+    return "",fmt.Errorf("Unknown fake kind '%s', expected one of %s", kind, strings.Join(fakeKinds(), ", "))
+  }
+
+  if len(seed) == 0 {
+    seed = make([]byte, 32)
+    if _,err := rand.Read(seed); err != nil {
+      return "",err
+    }
+  }
+
+  return faker(newKeyStream(seed, "fake:" + kind + ":" + value), value),nil
+}
+
+// fakeBuiltin implements "builtin:fake:<kind>".
+func fakeBuiltin(args string, value string, options Options) (string, error) {
+  return Fake(args, value, options.Seed)
+}
+
+func fakeBuiltinArgs(args string) error {
+  if _,ok := fakers[args]; !ok {
+    return fmt.Errorf("unknown fake kind '%s', expected one of %s", args, strings.Join(fakeKinds(), ", "))
+  }
+  return nil
+}
+
+func fakeKinds() []string {
+  kinds := make([]string, 0, len(fakers))
+  for kind := range fakers {
+    kinds = append(kinds, kind)
+  }
+  sort.Strings(kinds)
+  return kinds
+}
+
+func pick(s *keyStream, values []string) string {
+  return values[s.intn(len(values))]
+}
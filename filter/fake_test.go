@@ -0,0 +1,63 @@
+package filter
+
+import (
+	"testing"
+	"regexp"
+	"encoding/json"
+)
+
+func TestFake_kinds(t *testing.T) {
+	seed := []byte("42")
+	cases := []struct {
+		kind string
+		value string
+		pattern string
+	}{
+		{"name", "Darren Schnare", `^[A-Z][a-z]+ [A-Z][a-z]+$`},
+		{"email", "d@x.io", `^[a-z]+\.[a-z]+@example\.(com|net|org)$`},
+		{"address", "1 Main St", `^\d+ [A-Z][a-z]+ [A-Z][a-z]+, [A-Z][a-z]+$`},
+		{"company", "Acme", `^[A-Z][a-z]+ [A-Z][a-z]+$`},
+		{"lorem", "three word sentence", `^[a-z]+ [a-z]+ [a-z]+$`},
+		{"date", "18.10.2014", `^\d\d\.\d\d\.\d{4}$`},
+		{"date", "2014-10-18T10:00:00Z", `^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ$`},
+		{"uuid", "x", `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+	}
+
+	for _,c := range cases {
+		fake,err := Fake(c.kind, c.value, seed)
+		if err != nil {
+			t.Fatalf("Expected no error :: %v", err.Error())
+		} else if !regexp.MustCompile(c.pattern).MatchString(fake) {
+			t.Fatalf("Expected fake %v '%v' to match '%v'", c.kind, fake, c.pattern)
+		}
+		if again,_ := Fake(c.kind, c.value, seed); again != fake {
+			t.Fatalf("Expected seeded fakes to be reproducible got '%v' and '%v'", fake, again)
+		}
+	}
+
+	if _,err := Fake("ssn", "x", seed); err == nil {
+		t.Fatalf("Expected an error for an unknown kind")
+	}
+}
+
+func TestFakeBuiltin_seededFixture(t *testing.T) {
+	jsonText := `{"name": "Darren", "email": "d@x.io"}`
+	options := Options{Seed: []byte("fixtures")}
+	filter := "./fixtures/fake-filter.json"
+
+	first,err := FilterJsonFromTextWithOptions(jsonText, filter, options)
+	if err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+	second,_ := FilterJsonFromTextWithOptions(jsonText, filter, options)
+
+	a,_ := json.Marshal(first)
+	b,_ := json.Marshal(second)
+	if string(a) != string(b) || string(a) == jsonText {
+		t.Fatalf("Expected reproducible fake values got '%v' and '%v'", string(a), string(b))
+	}
+
+	if err := ValidateFilters(map[string]interface{}{"a": "builtin:fake:ssn"}); err == nil {
+		t.Fatalf("Expected an unknown fake kind to fail validation")
+	}
+}
@@ -9,7 +9,13 @@ each key can have a specific filter. Otherwise if filter is not a JSON file the
 for all string values found in the JSON data.
 
 Each filter is a command that will be executed on the command line with the string value to be
-filtered piped into stdin. The filtered value is expected to be piped to stdout.
+filtered piped into stdin. The filtered value is expected to be piped to stdout. Since most command
+line tools end their output with a newline, one trailing newline is removed; Options.Trim selects
+another policy and Options.InputNewline appends a newline to the input of each command.
+Options.Sandbox restricts the environment, working directory, resources and executables of commands;
+programs that set resource limits call SandboxMain first thing in main.
+Options.Limits bounds the size and nesting depth of JSON data and the output of filters, failing with a
+LimitError once a limit is exceeded.
 
 For example, to convert lowercase characters to uppercase:
 
@@ -19,6 +25,25 @@ Optionally you can override how filters are run by calling **WithFilterRunner().
 will run each filter as a command on the command line. You can use a custom filter runner to define a filter
 language of your own or use it to mock out a test.
 
+Functions ending in **WithOptions()** accept an Options value. Set Options.PathFilterRunner when the
+runner also needs to know where a value was found. Paths are passed as a Path that can be formatted as an
+RFC 6901 JSON Pointer or a JSONPath expression, and a failing filter is reported as a FilterError carrying
+the path of the offending value.
+
+Go values can be filtered directly with **FilterValue()**, which traverses structs, maps, slices,
+arrays and pointers the same way encoding/json encodes them, so filter paths match struct fields by
+their json tag names. **FilterInto()** decodes JSON data straight into a typed value and filters it, and
+**FilterIntoWithOptions()** does the same with options.
+
+JSON data held in bytes can be filtered with **FilterBytes()** and **FilterTo()** without decoding it
+into an interface{} value. Only string values are decoded, everything else is copied through as-is,
+which makes them considerably cheaper for large documents. Their output is compact and keeps the
+original order of object keys.
+
+**Compile()** loads and validates a filter once and returns a Filter that can be applied to any
+number of documents, which is how **Handler()** filters JSON response bodies in an http.Handler
+middleware and **RequestHandler()** filters JSON request bodies.
+
 To specify unique filters for specific JSON paths you can use a JSON file.
   
   // filter.json
@@ -134,6 +159,212 @@ that come after the last defined filter will not be filtered.
     "a": ["HELLO WORLD!", "apples", "This text will be left as-is."]
   }
 
+For anything else use an array rule: an object with a single "$array" key mapping selectors to
+filters. A selector is an index, a negative index counting from the end of the array, a slice
+"start:end" of indices up to but excluding end (either can be omitted, and both can be negative)
+or "$default" for every item no other selector matches. Indices win over slices, and the
+narrowest slice wins over wider ones.
+
+  // filter4b.json
+  {
+    "a": {"$array": {"0": "tr '[:lower:]' '[:upper:]'", "-1": "rev", "1:3": "tr -d aeiou"}}
+  }
+
+  // data5b.json
+  {
+    "a": ["first", "second", "third", "fourth", "last"]
+  }
+
+  // result
+  {
+    "a": ["FIRST", "scnd", "thrd", "fourth", "tsal"]
+  }
+
+When several rules could apply the most specific one wins. Inside an object of rules an exact key
+is tried first, then the "*" wildcard key, which matches any key. A "$default" command applies to
+every string value beneath its object that no more specific rule matches, including values deeper
+than the rules go, so a broad rule can be overridden for a few keys.
+
+  // filter4c.json
+  {
+    "user": {
+      "$default": "tr '[:lower:]' '[:upper:]'",
+      "id": "cat",
+      "*": {"name": "rev"}
+    }
+  }
+
+  // data5c.json
+  {
+    "user": {"id": "u1", "email": "a@b.c", "friend": {"name": "ann", "city": "oslo"}}
+  }
+
+  // result
+  {
+    "user": {"id": "u1", "email": "A@B.C", "friend": {"name": "nna", "city": "OSLO"}}
+  }
+
+A key written as "..<key>" is a recursive descent rule: it matches the key at any depth beneath the
+object it is declared in, regardless of the keys in between, like ".." in JSONPath. Its value is
+the rule for whatever lies beneath the matched key. Path-anchored rules (exact and "*" keys) take
+precedence over recursive descent rules, which take precedence over "$default". When a key occurs
+more than once along a path the occurrence nearest to the value wins.
+
+  // filter4d.json
+  {
+    "..address": {"city": "tr '[:lower:]' '[:upper:]'"},
+    "customer": {"address": {"city": "cat"}}
+  }
+
+  // data5d.json
+  {
+    "customer": {"address": {"city": "oslo"}},
+    "orders": [{"shipping": {"address": {"city": "bergen"}}}]
+  }
+
+  // result
+  {
+    "customer": {"address": {"city": "oslo"}},
+    "orders": [{"shipping": {"address": {"city": "BERGEN"}}}]
+  }
+
+By default string values that no rule matches are left as-is. Set the default action to "redact",
+"delete" or "error" to deny them instead. Fields that may pass through unfiltered are listed as
+JSONPath patterns in the "$allow" section of the filter file. A pattern allows the value at its
+own path and every value beneath it, and array indices can be written as "[*]".
+
+  // filter5.json
+  {
+    "$allow": ["$.id", "$.items[*].sku"],
+    "name": "tr '[:lower:]' '[:upper:]'"
+  }
+
+  // data6.json, filtered with the "redact" default action
+  {
+    "id": "42", "name": "darren", "email": "d@example.com", "items": [{"sku": "a1", "note": "gift"}]
+  }
+
+  // result
+  {
+    "id": "42", "name": "DARREN", "email": "[REDACTED]", "items": [{"sku": "a1", "note": "[REDACTED]"}]
+  }
+
+A filter's output replaces the string as a string. To change the type of the value, use a command
+rule instead of a command string: an object with a "$command" key and an "$output" key naming the
+output mode. The "number", "bool" and "json" modes parse the output, ignoring surrounding whitespace,
+and fail when it is not a number, a boolean (true, false, 1 or 0) or JSON. The "auto" mode parses
+JSON output and keeps anything else as a string, and "string" is the default. A command rule can be used wherever a command
+can, including as a "$default" rule.
+
+  // filter4e.json
+  {
+    "words": {"$command": "wc -w", "$output": "number"},
+    "tags": {"$command": "jq -c -R split(\",\")", "$output": "json"}
+  }
+
+  // data5e.json
+  {
+    "words": "one two three", "tags": "a,b"
+  }
+
+  // result
+  {
+    "words": 3, "tags": ["a", "b"]
+  }
+
+Filter files can share rules. Files listed in the "$include" section are merged under the rules
+of the including file, paths being relative to it. Named profiles are declared in the "$profiles"
+section and selected with the profile option; a profile's rules are merged over the top-level rules,
+and "$extends" names the profiles, in order, whose rules it builds on. Objects of rules are merged
+key by key, "$allow" sections are combined and any other rule, command and array rules included,
+replaces the rule it overrides.
+
+  // base.json
+  {
+    "$allow": ["$.id"],
+    "email": "builtin:pseudonymize:email"
+  }
+
+  // exports.json, filtered with the "partner" profile
+  {
+    "$include": ["base.json"],
+    "name": "tr '[:lower:]' '[:upper:]'",
+    "$profiles": {
+      "support": {"$allow": ["$.ticket"]},
+      "partner": {"$extends": "support", "name": "builtin:fake:name"}
+    }
+  }
+
+A filter file can also be a JSON Schema, recognized by its "$schema" keyword. The "x-filter"
+keyword of a schema holds the command for the values it describes and everything beneath them,
+and string values with a "format" keyword use a default command: email addresses, dates and UUIDs
+are faked, IP addresses are detected. The "x-filter-formats" keyword of the root schema maps formats
+to other commands. References within the schema ("$ref": "#/$defs/name") are resolved, and "oneOf"
+and "anyOf" are resolved against the data: the first "oneOf" branch and every "anyOf" branch the
+value is valid against apply. A "$ref" may lead back to an enclosing schema only through properties
+or items, so a schema that applies itself to the same value forever is rejected. Schemas cannot be
+combined with includes or profiles. Keywords that are not supported, such as "propertyNames",
+"unevaluatedProperties" or "$dynamicRef", are rejected rather than ignored. LoadSchema loads a
+schema to validate filtered documents against instead; Schema.Validate reports every value that
+does not satisfy it with its path.
+
+  // person.schema.json
+  {
+    "$schema": "https://json-schema.org/draft/2020-12/schema",
+    "properties": {
+      "name": {"type": "string", "x-filter": "builtin:fake:name"},
+      "email": {"type": "string", "format": "email"},
+      "contact": {"oneOf": [
+        {"properties": {"kind": {"const": "phone"}, "value": {"x-filter": "builtin:detect:phone"}}},
+        {"properties": {"kind": {"const": "note"}}}
+      ]},
+      "home": {"$ref": "#/$defs/address"}
+    },
+    "$defs": {"address": {"properties": {"street": {"x-filter": "builtin:fake:address"}}}}
+  }
+
+Commands that start with "builtin:" are built-in filters that run in-process regardless of the
+filter runner. The "builtin:detect" filter masks secrets and personal information found anywhere
+inside a string with "[REDACTED:<detector>]". Detectors can be selected by name, i.e.
+"builtin:detect:email,phone". The available detectors are email, phone, credit-card (Luhn checked),
+iban (checksum verified), ipv4, ipv6, jwt, aws-key and entropy (generic high-entropy tokens).
+To mask every string value regardless of the rules in the filter use the scan option.
+
+  // filter6.json
+  {
+    "message": "builtin:detect"
+  }
+
+  // data7.json
+  {
+    "message": "contact darren@example.com from 10.0.0.1"
+  }
+
+  // result
+  {
+    "message": "contact [REDACTED:email] from [REDACTED:ipv4]"
+  }
+
+The "builtin:pseudonymize" filter replaces a value with a fake value derived from an HMAC keyed by
+a secret, so the same input maps to the same pseudonym in every document. The format of the value is
+preserved: "builtin:pseudonymize:email" produces email addresses, "uuid" produces UUIDs, "digits"
+replaces only digits, "chars" replaces letters and digits while keeping case and punctuation,
+"token" produces a hex token and "auto" (the default) picks one based on the value. The secret is
+read from the secret-file option or the JSONFILTER_SECRET environment variable, and the mapping
+option exports a table of pseudonyms to original values for authorized reversal.
+
+The "builtin:encrypt" and "builtin:decrypt" filters encrypt values with AES-GCM using the key read
+from the key-file option or the JSONFILTER_KEY environment variable. The key is hashed with SHA-256
+into an AES-256 key. The "fpe" mode, i.e. "builtin:encrypt:fpe", is an FF1 format-preserving mode that
+encrypts only the digits of a value so a card number stays a card number, and "fpe-alnum" encrypts
+letters and digits. Format-preserving modes are deterministic and need at least six digits or four
+letters and digits.
+
+The "builtin:fake:<kind>" filters replace values with realistic fake data for test fixtures. The
+kinds are name, email, address, company, lorem (same number of words), date (same layout) and uuid.
+Fake values are random unless the seed option is specified, in which case the same seed and value
+always produce the same fake value.
+
 */
 package filter
 
@@ -142,10 +373,8 @@ import (
   "fmt"
   "os/exec"
   "io"
-  "bytes"
   "bufio"
   "strings"
-  "strconv"
   "encoding/json"
 )
 
@@ -153,17 +382,149 @@ import (
 // Each filter runner function is passed the raw command to run and the string value to filter.
 type FilterRunner func(command string, value string) (string, error)
 
-type visitorFunc func(path string, value string) (string, error)
+// PathFilterRunner defines the function signature used to override how filters are run when the
+// runner also needs to know where the string value was found. It is passed the path of the string value,
+// the raw command to run and the string value to filter.
+type PathFilterRunner func(path Path, command string, value string) (string, error)
+
+// Options controls how JSON data is filtered.
+type Options struct {
+  // FilterRunner overrides how filters are run. By default each filter is run as a command on the command line.
+  FilterRunner FilterRunner
+  // PathFilterRunner overrides how filters are run and takes precedence over FilterRunner.
+  PathFilterRunner PathFilterRunner
+  // Strict causes filtering to fail with an UnmatchedRulesError when a rule in the filter
+  // never matched a string value.
+  Strict bool
+  // Report, when set, collects the coverage of every string value filtered.
+  Report *Report
+  // DefaultAction is applied to every string value that no rule matched and that is not listed
+  // in the "$allow" section of the filter file. Defaults to ActionPass.
+  DefaultAction Action
+  // Scan lists the detectors used to mask secrets and personal information in every string value,
+  // independent of the rules in the filter. Scanning happens after rules are applied. See Mask.
+  Scan []string
+  // Secret keys the built-in filters that derive values from an HMAC, such as "builtin:pseudonymize".
+  Secret []byte
+  // Mapping, when set, records the original value of every pseudonym produced by "builtin:pseudonymize".
+  // Filtering fails when two different values share a pseudonym. See Mapping.
+  Mapping *Mapping
+  // EncryptionKey keys the "builtin:encrypt" and "builtin:decrypt" filters.
+  EncryptionKey []byte
+  // Seed makes the "builtin:fake" filters reproducible. The same seed and value always produce the
+  // same fake value. Fake values are random when Seed is empty.
+  Seed []byte
+  // Cache, when set, memoizes filter results keyed by command and value. See Cache for when a
+  // cache can be shared.
+  Cache *Cache
+  // Reverse undoes a previous filtering with the same filter. Each built-in filter that can be undone
+  // is replaced by its inverse, i.e. "builtin:encrypt" decrypts. Every other value is left as-is and
+  // DefaultAction and Scan are ignored.
+  Reverse bool
+  // Profile selects a profile declared in the "$profiles" section of the filter file. Its rules
+  // are merged over the top-level rules.
+  Profile string
+  // Trim normalizes the output of filter commands run on the command line. Defaults to TrimNewline.
+  Trim TrimPolicy
+  // InputNewline appends a newline to each value piped to a filter command run on the command line,
+  // unless the value already ends with one. Many command line tools expect their input to end
+  // with a newline.
+  InputNewline bool
+  // Sandbox, when set, restricts the environment, working directory, resources and executables of
+  // filter commands run on the command line. See Sandbox.
+  Sandbox *Sandbox
+  // Limits guards against huge or deeply nested JSON data and filters that produce too much output.
+  Limits Limits
+}
+
+// Action determines what happens to a string value that no rule matched.
+type Action string
+
+const (
+  // ActionPass leaves the value as-is.
+  ActionPass Action = "pass"
+  // ActionRedact replaces the value with Redacted.
+  ActionRedact Action = "redact"
+  // ActionDelete removes the value from its object or array.
+  ActionDelete Action = "delete"
+  // ActionError fails filtering with an UnmatchedValueError.
+  ActionError Action = "error"
+)
+
+// Redacted replaces string values redacted by ActionRedact.
+const Redacted = "[REDACTED]"
+
+// ParseAction converts the name of an action to an Action. The empty string is ActionPass.
+func ParseAction(name string) (Action, error) {
+  switch action := Action(name); action {
+  case "": return ActionPass,nil
+  case ActionPass, ActionRedact, ActionDelete, ActionError: return action,nil
+  }
+  return "",fmt.Errorf("Unknown action '%s', expected one of pass, redact, delete or error", name)
+}
+
+// TrimPolicy determines how the output of a filter command run on the command line is normalized.
+// Most command line tools end their output with a newline that is not part of the value.
+type TrimPolicy string
+
+const (
+  // TrimNewline removes one trailing newline, either "\n" or "\r\n".
+  TrimNewline TrimPolicy = "newline"
+  // TrimSpace removes all leading and trailing whitespace.
+  TrimSpace TrimPolicy = "space"
+  // TrimNone keeps the output verbatim.
+  TrimNone TrimPolicy = "none"
+)
+
+// ParseTrimPolicy converts the name of a trim policy to a TrimPolicy. The empty string is
+// TrimNewline.
+func ParseTrimPolicy(name string) (TrimPolicy, error) {
+  switch policy := TrimPolicy(name); policy {
+  case "": return TrimNewline,nil
+  case TrimNewline, TrimSpace, TrimNone: return policy,nil
+  }
+  return "",fmt.Errorf("Unknown trim policy '%s', expected one of newline, space or none", name)
+}
+
+func (policy TrimPolicy) trim(output string) string {
+  switch policy {
+  case TrimNone: return output
+  case TrimSpace: return strings.TrimSpace(output)
+  }
+  if strings.HasSuffix(output, "\n") {
+    output = strings.TrimSuffix(strings.TrimSuffix(output, "\n"), "\r")
+  }
+  return output
+}
+
+// FilterError is returned when a filter fails to filter a string value.
+type FilterError struct {
+  Path Path
+  Command string
+  Err error
+}
+
+func (e *FilterError) Error() string {
+  return fmt.Sprintf("Filter '%s' failed at %s :: %v", e.Command, e.Path, e.Err)
+}
+
+// UnmatchedValueError is returned by ActionError when no rule matched a string value.
+type UnmatchedValueError struct {
+  Path Path
+}
+
+func (e *UnmatchedValueError) Error() string {
+  return fmt.Sprintf("No rule matched the string value at %s", e.Path)
+}
+
+type visitorFunc func(path Path, value string) (interface{}, error)
 
 // FilterJsonFromText filters JSON data from text. The filter can either be a command
 // or a path to a JSON file. If filter is a command then all string values found in the JSON data
 // will be filtered using the command. Returns the unmarshalled JSON data with all string values filtered.
 // See http://golang.org/pkg/encoding/json/#Unmarshal for more details on the value returned.
 func FilterJsonFromText(jsonText string, filter string) (value interface{},  err error) {
-  if value,err = readJsonFromText(jsonText); err == nil {
-    err = doFilter(value, filter, nil)
-  }
-  return
+  return FilterJsonFromTextWithOptions(jsonText, filter, Options{})
 }
 
 // FilterJsonFromText filters JSON data from text using a custom filter runner. The filter can either be a command
@@ -171,8 +532,17 @@ func FilterJsonFromText(jsonText string, filter string) (value interface{},  err
 // will be filtered using the command. Returns the unmarshalled JSON data with all string values filtered.
 // See http://golang.org/pkg/encoding/json/#Unmarshal for more details on the value returned.
 func FilterJsonFromTextWithFilterRunner(jsonText string, filter string, filterRunner FilterRunner) (value interface{},  err error) {
+  return FilterJsonFromTextWithOptions(jsonText, filter, Options{FilterRunner: filterRunner})
+}
+
+// FilterJsonFromTextWithOptions filters JSON data from text using the specified options.
+// See FilterJsonFromText for details on the filter argument and the value returned.
+func FilterJsonFromTextWithOptions(jsonText string, filter string, options Options) (value interface{},  err error) {
+  if err = options.Limits.checkInput(len(jsonText)); err != nil {
+    return
+  }
   if value,err = readJsonFromText(jsonText); err == nil {
-    err = doFilter(value, filter, filterRunner)
+    value,_,err = doFilter(value, filter, options)
   }
   return
 }
@@ -182,10 +552,7 @@ func FilterJsonFromTextWithFilterRunner(jsonText string, filter string, filterRu
 // will be filtered using the command. Returns the unmarshalled JSON data with all string values filtered.
 // See http://golang.org/pkg/encoding/json/#Unmarshal for more details on the value returned.
 func FilterJsonFromReader(reader io.Reader, filter string) (value interface{}, err error) {
-  if value,err = readJsonFromReader(reader); err == nil {
-    err = doFilter(value, filter, nil)
-  }
-  return
+  return FilterJsonFromReaderWithOptions(reader, filter, Options{})
 }
 
 // FilterJsonFromText filters JSON data from a reader using a custom filter runner. The filter can either be a command
@@ -193,94 +560,310 @@ func FilterJsonFromReader(reader io.Reader, filter string) (value interface{}, e
 // will be filtered using the command. Returns the unmarshalled JSON data with all string values filtered.
 // See http://golang.org/pkg/encoding/json/#Unmarshal for more details on the value returned.
 func FilterJsonFromReaderWithFilterRunner(reader io.Reader, filter string, filterRunner FilterRunner) (value interface{}, err error) {
-  if value,err = readJsonFromReader(reader); err == nil {
-    err = doFilter(value, filter, filterRunner)
+  return FilterJsonFromReaderWithOptions(reader, filter, Options{FilterRunner: filterRunner})
+}
+
+// FilterJsonFromReaderWithOptions filters JSON data from a reader using the specified options.
+// See FilterJsonFromText for details on the filter argument and the value returned.
+func FilterJsonFromReaderWithOptions(reader io.Reader, filter string, options Options) (value interface{}, err error) {
+  if value,err = readJsonFromReader(options.Limits.Reader(reader)); err == nil {
+    value,_,err = doFilter(value, filter, options)
   }
   return
 }
 
-func doFilter(value interface{}, filter string, filterRunner FilterRunner) (err error) {
-  var filters interface{}
+func doFilter(value interface{}, filter string, options Options) (result interface{}, patch Patch, err error) {
+  var f *Filter
 
-  if filters,err = loadFilters(filter); err == nil {
-    _,err = traverse(value, func (path string, value string) (string, error) {
-      return doRunFilter(path, value, filters, filterRunner)
-    })
+  result = value
+
+  if f,err = Compile(filter, options); err == nil {
+    result,patch,err = f.Value(value)
   }
 
   return
 }
 
-func doRunFilter(path string, value string, filters interface{}, filterRunner FilterRunner) (result string, err error) {
-  if command,ok := getFilterCommand(path, filters); ok {
-    if filterRunner == nil {
-      return commandLineFilterRunner(command, value)
+// filterRun holds the state of filtering a single document. Visit is called for every string
+// value in the document and finish once every value has been visited.
+type filterRun struct {
+  filters *spec
+  options Options
+  replacements Patch
+  removals Patch
+  matched map[string]bool
+  // output is the combined size of the output of every filter run so far.
+  output int64
+}
+
+func (run *filterRun) visit(path Path, value string) (result interface{}, err error) {
+  options := run.options
+  command,mode,rule,ok := run.filters.command(path)
+  allowed := !ok && run.filters.allowed(path)
+  if options.Report != nil {
+    options.Report.record(path, command, ok, allowed)
+  }
+
+  if options.Reverse {
+    if ok {
+      run.matched[rule.Pointer()] = true
+      if result,err = runInverse(command, value, options); err != nil {
+        err = &FilterError{Path: path, Command: command, Err: err}
+      } else if str,ok := result.(string); ok {
+        err = run.checkOutput(path, str)
+      }
     } else {
-      return filterRunner(command, value)
+      result = value
     }
-  } else {
+  } else if ok {
+    run.matched[rule.Pointer()] = true
+    if result,err = doRunFilter(path, value, command, options); err == nil {
+      err = run.checkOutput(path, result.(string))
+    }
+    if err == nil && mode != OutputString {
+      if result,err = parseOutput(result.(string), mode); err != nil {
+        err = &FilterError{Path: path, Command: command, Err: err}
+      }
+    }
+  } else if allowed {
     result = value
+  } else {
+    result,err = doDefaultAction(path, value, options)
+  }
+
+  if str,ok := result.(string); ok && err == nil && len(options.Scan) > 0 && !options.Reverse {
+    result,err = Mask(str, options.Scan)
+  }
+
+  if err != nil {
+    return
+  } else if result == removed {
+    run.removals = append(run.removals, Operation{Op: "remove", Path: path.Pointer()})
+  } else if result != value {
+    run.replacements = append(run.replacements, Operation{Op: "replace", Path: path.Pointer(), Value: result})
+  }
+  return
+}
+
+// finish returns the patch of every modification made during the run and, in strict mode,
+// fails if a rule never matched.
+func (run *filterRun) finish() (patch Patch, err error) {
+  patch = run.replacements
+  // Removals are applied after every replacement and in reverse document order so that
+  // removing an array item never shifts the index of another operation.
+  for k := len(run.removals) - 1; k >= 0; k-- {
+    patch = append(patch, run.removals[k])
+  }
+
+  if run.options.Strict {
+    err = checkUnmatchedRules(run.filters.rules, run.matched)
   }
 
   return
 }
 
-func commandLineFilterRunner(command string, value string) (result string, err error) {
-  var out bytes.Buffer
+func doRunFilter(path Path, value string, command string, options Options) (interface{}, error) {
+  var (
+    result string
+    err error
+  )
+
+  var key cacheKey
+  cached := options.Cache != nil && options.Cache.cacheable(command, options)
+  if cached {
+    key = newCacheKey(path, command, value, options)
+    if result,ok := options.Cache.get(key); ok {
+      return result,nil
+    }
+  }
+
+  if IsBuiltin(command) {
+    result,err = runBuiltin(command, value, options)
+  } else {
+    result,err = options.runner()(path, command, value)
+  }
+
+  if err != nil {
+    return nil,&FilterError{Path: path, Command: command, Err: err}
+  } else if cached {
+    options.Cache.put(key, result)
+  }
+
+  return result,nil
+}
+
+func doDefaultAction(path Path, value string, options Options) (interface{}, error) {
+  switch options.DefaultAction {
+  case ActionRedact: return Redacted,nil
+  case ActionDelete: return removed,nil
+  case ActionError: return nil,&UnmatchedValueError{Path: path}
+  }
+
+  return value,nil
+}
+
+func (options Options) runner() PathFilterRunner {
+  if options.PathFilterRunner != nil {
+    return options.PathFilterRunner
+  } else if options.FilterRunner != nil {
+    return func (path Path, command string, value string) (string, error) {
+      return options.FilterRunner(command, value)
+    }
+  }
+
+  return func (path Path, command string, value string) (string, error) {
+    return commandLineFilterRunner(command, value, options)
+  }
+}
+
+// commandLineFilterRunner runs a filter command with the value as its input and returns its output
+// normalized by the trim policy of options. The command is restricted by the sandbox of options,
+// if any.
+func commandLineFilterRunner(command string, value string, options Options) (result string, err error) {
+  out := &outputBuffer{max: options.Limits.FilterOutput}
+  if options.Sandbox != nil {
+    out.max = options.Sandbox.outputLimit(out.max)
+  }
   parts := strings.Split(command, " ")
   cmd := exec.Command(parts[0], parts[1:]...)
+  if options.InputNewline && !strings.HasSuffix(value, "\n") {
+    value += "\n"
+  }
   cmd.Stdin = strings.NewReader(value)
-  cmd.Stdout = &out
+  cmd.Stdout = out
+
+  if options.Sandbox == nil {
+    err = cmd.Run()
+  } else if err = cmd.Err; err == nil {
+    if err = options.Sandbox.prepare(cmd, parts[0]); err == nil {
+      err = cmd.Run()
+    }
+  }
 
-  if err = cmd.Run(); err == nil {
-    result = out.String()
+  if out.exceeded {
+    // The command fails once its output is no longer read, which is not its fault.
+    err = &LimitError{Limit: LimitFilterOutput, Max: out.max}
+  } else if err == nil {
+    result = options.Trim.trim(out.String())
   }
 
   return
 }
 
-func getFilterCommand(path string, filters interface{}) (command string, found bool) {
-  var filterCommand interface{}
-  // Path will be of the form:
-  // ['key']['key'][num]['key'][num]
-  keys := strings.FieldsFunc(path, func (r rune) bool {
-    return r == '[' || r == ']'
-  })
+// getFilterCommand resolves the command to use for the string value at path. See getFilterRule.
+func getFilterCommand(path Path, filters interface{}) (command string, rule Path, found bool) {
+  var filterRule interface{}
+  if filterRule,rule,found = getFilterRule(path, filters); found {
+    command,_,found = ruleCommand(filterRule)
+  }
+  return
+}
+
+// getFilterRule resolves the command string or command rule to use for the string value at path.
+// The rule path returned is the location of the command within the filters. The most specific rule
+// wins: an exact key is tried before the "*" wildcard key, then "..<key>" recursive descent rules,
+// and the nearest "$default" rule applies when none of them match.
+func getFilterRule(path Path, filters interface{}) (filterRule interface{}, rule Path, found bool) {
+  var fallback *ruleMatch
 
-  if filterCommand,found = getFilterCommandRec(keys, filters); found {
-    command,found = filterCommand.(string)
+  if filterRule,rule,found,fallback = getFilterCommandRec(path, filters, Path{}); !found && fallback != nil {
+    filterRule,rule,found = fallback.filters,fallback.rule,true
+  }
+  if found {
+    _,_,found = ruleCommand(filterRule)
   }
 
   return
 }
 
-func getFilterCommandRec(keys []string, filters interface{}) (interface{}, bool) {
-  if len(keys) == 0 {
-    return filters,true
+// matchDescendant tries the recursive descent rules of an object of rules. A key written as
+// "..<key>" matches the key anywhere beneath the object, and the occurrence of the key nearest to
+// the value wins.
+func matchDescendant(path Path, m map[string]interface{}, rule Path) (interface{}, Path, bool, *ruleMatch) {
+  var fallback *ruleMatch
+
+  for k := len(path) - 1; k >= 0; k-- {
+    if path[k].IsIndex {
+      continue
+    }
+    key := descentPrefix + path[k].Key
+    if v,ok := m[key]; ok {
+      if f,r,found,fb := getFilterCommandRec(path[k + 1:], v, rule.Append(Key(key))); found {
+        return f,r,true,nil
+      } else if fallback == nil {
+        fallback = fb
+      }
+    }
+  }
+
+  return nil,nil,false,fallback
+}
+
+// ruleMatch is a rule and its location within the filters.
+type ruleMatch struct {
+  filters interface{}
+  rule Path
+}
+
+// getFilterCommandRec returns the rule for path within filters. When no rule matches it returns
+// the most specific "$default" rule found along the way, if any.
+func getFilterCommandRec(path Path, filters interface{}, rule Path) (interface{}, Path, bool, *ruleMatch) {
+  if len(path) == 0 {
+    // A value found where an object or array of rules was expected is left to the enclosing
+    // "$default" rule.
+    _,_,ok := ruleCommand(filters)
+    return filters,rule,ok,nil
   }
 
-  key := strings.Trim(keys[0], "'")
+  elem := path[0]
 
   switch filters.(type) {
   case string: 
-    return filters,true
+    return filters,rule,true,nil
   case map[string]interface{}:
     m := filters.(map[string]interface{})
-    if v,ok := m[key]; ok {
-      return getFilterCommandRec(keys[1:], v)
-    } else {
-      return nil,false
+    if isCommandRule(m) {
+      return filters,rule,true,nil
+    } else if selectors,ok := m[arraySection].(map[string]interface{}); ok {
+      if !elem.IsIndex {
+        return nil,nil,false,nil
+      } else if selector,v,ok := matchArrayRule(elem, selectors); ok {
+        return getFilterCommandRec(path[1:], v, rule.Append(Key(arraySection)).Append(Key(selector)))
+      }
+      return nil,nil,false,nil
+    }
+
+    var fallback *ruleMatch
+    if !elem.IsIndex {
+      for _,k := range []string{elem.Key, wildcardKey} {
+        if v,ok := m[k]; ok && k != defaultRule {
+          if f,r,found,fb := getFilterCommandRec(path[1:], v, rule.Append(Key(k))); found {
+            return f,r,true,nil
+          } else if fallback == nil {
+            fallback = fb
+          }
+        }
+      }
+    }
+    if f,r,found,fb := matchDescendant(path, m, rule); found {
+      return f,r,true,nil
+    } else if fallback == nil {
+      fallback = fb
     }
+    if v,ok := m[defaultRule]; ok && fallback == nil {
+      fallback = &ruleMatch{v, rule.Append(Key(defaultRule))}
+    }
+    return nil,nil,false,fallback
   case []interface{}:
     s := filters.([]interface{})
     if len(s) == 1 {
-      return getFilterCommandRec(keys[1:], s[0])
-    } else if i,err := strconv.ParseInt(key, 10, 32); err == nil && i < int64(len(s)) && i >= 0 {
-      return getFilterCommandRec(keys[1:], s[i])
+      return getFilterCommandRec(path[1:], s[0], rule.Append(Index(0)))
+    } else if elem.IsIndex && elem.Index < len(s) && elem.Index >= 0 {
+      return getFilterCommandRec(path[1:], s[elem.Index], rule.Append(elem))
     } else {
-      return nil,false
+      return nil,nil,false,nil
     }
-  default: return nil,false
+  default: return nil,nil,false,nil
   }
 }
 
@@ -306,22 +889,22 @@ func readJsonFromReader(reader io.Reader) (value interface{}, err error) {
     err = nil
   }
 
-  return
+  return value,inputError(reader, err)
 }
 
-func loadFilters(filter string) (interface{}, error) {
-  if strings.HasSuffix(filter, ".json") {
-    return readJsonFromFile(filter)
-  } else {
-    return filter,nil
-  }
-}
+type removedValue struct{}
+
+// removed is returned by a visitor to remove the visited value from its parent.
+var removed = removedValue{}
 
-func traverse(value interface{}, visit visitorFunc) (interface{}, error) {
-  return traverseWithPath(value, "", visit)
+func traverse(value interface{}, visit visitorFunc) (result interface{}, err error) {
+  if result,err = traverseWithPath(value, Path{}, visit); result == removed {
+    result = nil
+  }
+  return
 }
 
-func traverseWithPath(value interface{}, path string, visit visitorFunc) (interface{}, error) {
+func traverseWithPath(value interface{}, path Path, visit visitorFunc) (interface{}, error) {
   switch value.(type) {
   case string: return visit(path, value.(string))
   case map[string]interface{}: return traverseMap(value.(map[string]interface{}), path, visit)
@@ -333,23 +916,36 @@ func traverseWithPath(value interface{}, path string, visit visitorFunc) (interf
   return value,nil
 }
 
-func traverseMap(m map[string]interface{}, path string, visit visitorFunc) (value interface{}, err error) {
+func traverseMap(m map[string]interface{}, path Path, visit visitorFunc) (value interface{}, err error) {
+  var v interface{}
+
   value = m
-  for k,v := range m {
-    if m[k],err = traverseWithPath(v, fmt.Sprintf("%s['%s']", path, k), visit); err != nil {
+  // Keys are visited in sorted order so that patches and errors are deterministic.
+  for _,k := range sortedKeys(m) {
+    if v,err = traverseWithPath(m[k], path.Append(Key(k)), visit); err != nil {
       break
+    } else if v == removed {
+      delete(m, k)
+    } else {
+      m[k] = v
     }
   }
   return
 }
 
-func traverseSlice(s *[]interface{}, path string, visit visitorFunc) (value interface{}, err error) {
+func traverseSlice(s *[]interface{}, path Path, visit visitorFunc) (value interface{}, err error) {
+  var v interface{}
+
   slice := *s
-  value = slice
-  for k,v := range slice {
-    if slice[k],err = traverseWithPath(v, fmt.Sprintf("%s[%d]", path, k), visit); err != nil {
+  kept := slice[:0]
+  for k := range slice {
+    if v,err = traverseWithPath(slice[k], path.Append(arrayIndex(k, len(slice))), visit); err != nil {
+      kept = append(kept, slice[k:]...)
       break
+    } else if v != removed {
+      kept = append(kept, v)
     }
   }
+  value = kept
   return
-}
\ No newline at end of file
+}
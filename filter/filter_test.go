@@ -338,6 +338,33 @@ func TestFilterJsonText_commandLine(t *testing.T) {
 	}
 }
 
+func TestFilterJsonText_commandLineNewlines(t *testing.T) {
+	tests := []struct {
+		options  Options
+		value    string
+		expected string
+	}{
+		{Options{InputNewline: true}, "abc", "abc"},
+		{Options{InputNewline: true, Trim: TrimNone}, "abc", "abc\n"},
+		{Options{Trim: TrimNone}, "abc", "abc"},
+		{Options{}, "abc\n\n", "abc\n"},
+		{Options{Trim: TrimSpace}, " abc \r\n\n", "abc"},
+		{Options{InputNewline: true}, "abc\r\n", "abc"},
+	}
+
+	for _,test := range tests {
+		if result,err := commandLineFilterRunner("cat", test.value, test.options); err != nil {
+			t.Fatalf("Expected no error :: %v", err.Error())
+		} else if result != test.expected {
+			t.Fatalf("Expected %q for %q with %+v got %q", test.expected, test.value, test.options, result)
+		}
+	}
+
+	if _,err := ParseTrimPolicy("lines"); err == nil {
+		t.Fatalf("Expected an error for an unknown trim policy")
+	}
+}
+
 // ---
 
 func testValue(value interface{}, expected interface{}, t *testing.T) {
@@ -0,0 +1,194 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "bytes"
+  "errors"
+  "fmt"
+  "io"
+)
+
+// Limits guards against huge or deeply nested documents and against filters that produce too
+// much output. Together the input size and output size limits bound the size of a filtered
+// document. A zero value means no limit.
+type Limits struct {
+  // Input limits the size of JSON data, in bytes. Handler and RequestHandler stop buffering a
+  // body at the limit.
+  Input int64
+  // Depth limits how deeply objects and arrays of JSON data can be nested. The root object or
+  // array has a depth of 1. The structs, maps, slices and arrays of Go values given to
+  // FilterValue count the same way.
+  Depth int
+  // FilterOutput limits the output of a single filter, in bytes. The output of a filter command
+  // is never read beyond the limit.
+  FilterOutput int64
+  // Output limits the combined output of every filter run on a document, in bytes.
+  Output int64
+}
+
+// The limits a LimitError can report.
+const (
+  LimitInput = "input size"
+  LimitDepth = "depth"
+  LimitFilterOutput = "filter output size"
+  LimitOutput = "output size"
+)
+
+// LimitError is returned when filtering exceeds one of the Limits. Path is the location of the
+// value that exceeded the limit and is nil for the input size limit.
+type LimitError struct {
+  Limit string
+  Max int64
+  Path Path
+}
+
+func (e *LimitError) Error() string {
+  unit := " bytes"
+  if e.Limit == LimitDepth {
+    unit = ""
+  }
+
+  if e.Path == nil {
+    return fmt.Sprintf("Exceeded the %s limit of %d%s", e.Limit, e.Max, unit)
+  }
+  return fmt.Sprintf("Exceeded the %s limit of %d%s at %s", e.Limit, e.Max, unit, e.Path)
+}
+
+// Reader returns a reader that fails with a LimitError once more than the input size limit is
+// read from r.
+func (l Limits) Reader(r io.Reader) io.Reader {
+  if l.Input <= 0 {
+    return r
+  }
+  return &limitedReader{r: r, remaining: l.Input, max: l.Input}
+}
+
+type limitedReader struct {
+  r io.Reader
+  remaining int64
+  max int64
+  err error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+  if l.err != nil {
+    return 0,l.err
+  }
+
+  // Reading one byte past the limit tells an input that is exactly as large as the limit
+  // apart from a larger one.
+  if int64(len(p)) > l.remaining + 1 {
+    p = p[:l.remaining + 1]
+  }
+
+  n,err := l.r.Read(p)
+  if int64(n) > l.remaining {
+    // The byte past the limit is held back so a decoder never sees a complete value.
+    n,l.remaining = int(l.remaining),0
+    l.err = &LimitError{Limit: LimitInput, Max: l.max}
+    return n,l.err
+  }
+  l.remaining -= int64(n)
+  return n,err
+}
+
+// inputError returns the LimitError of a reader returned by Limits.Reader when it stopped reading
+// at the limit, since a decoder may report a read error as an unexpected end of input. Otherwise
+// err is returned.
+func inputError(reader io.Reader, err error) error {
+  if l,ok := reader.(*limitedReader); ok && err != nil && l.err != nil {
+    return l.err
+  }
+  return err
+}
+
+// checkInput fails when JSON data of size bytes exceeds the input size limit.
+func (l Limits) checkInput(size int) error {
+  if l.Input > 0 && int64(size) > l.Input {
+    return &LimitError{Limit: LimitInput, Max: l.Input}
+  }
+  return nil
+}
+
+// checkDepth fails when objects and arrays beneath path in value are nested deeper than the
+// depth limit.
+func (l Limits) checkDepth(value interface{}, path Path) error {
+  if l.Depth <= 0 {
+    return nil
+  }
+
+  switch v := value.(type) {
+  case map[string]interface{}:
+    if err := l.checkNesting(path); err != nil {
+      return err
+    }
+    for _,k := range sortedKeys(v) {
+      if err := l.checkDepth(v[k], path.Append(Key(k))); err != nil {
+        return err
+      }
+    }
+  case []interface{}:
+    if err := l.checkNesting(path); err != nil {
+      return err
+    }
+    for k,item := range v {
+      if err := l.checkDepth(item, path.Append(Index(k))); err != nil {
+        return err
+      }
+    }
+  }
+  return nil
+}
+
+// checkNesting fails when an object or array at path is nested deeper than the depth limit.
+func (l Limits) checkNesting(path Path) error {
+  if l.Depth > 0 && len(path) >= l.Depth {
+    return &LimitError{Limit: LimitDepth, Max: int64(l.Depth), Path: path}
+  }
+  return nil
+}
+
+// checkOutput counts the output of a filter run at path against the filter output and output
+// size limits.
+func (run *filterRun) checkOutput(path Path, output string) error {
+  limits := run.options.Limits
+  if limits.FilterOutput > 0 && int64(len(output)) > limits.FilterOutput {
+    return &LimitError{Limit: LimitFilterOutput, Max: limits.FilterOutput, Path: path}
+  }
+
+  run.output += int64(len(output))
+  if limits.Output > 0 && run.output > limits.Output {
+    return &LimitError{Limit: LimitOutput, Max: limits.Output, Path: path}
+  }
+  return nil
+}
+
+var errOutputLimit = errors.New("output limit exceeded")
+
+// outputBuffer collects the output of a filter command or a JSON response, failing once more than
+// max bytes are written. Max is 0 when there is no limit. The buffer is not embedded since its ReadFrom method
+// would bypass the limit.
+type outputBuffer struct {
+  buf bytes.Buffer
+  max int64
+  exceeded bool
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+  if b.max > 0 && int64(b.buf.Len() + len(p)) > b.max {
+    b.exceeded = true
+    return 0,errOutputLimit
+  }
+  return b.buf.Write(p)
+}
+
+func (b *outputBuffer) String() string {
+  return b.buf.String()
+}
+
+func (b *outputBuffer) Bytes() []byte {
+  return b.buf.Bytes()
+}
@@ -0,0 +1,72 @@
+package filter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func expectLimitError(t *testing.T, err error, limit string, pointer string) {
+	var e *LimitError
+	if !errors.As(err, &e) {
+		t.Fatalf("Expected a LimitError got %v", err)
+	} else if e.Limit != limit || (e.Path != nil && e.Path.Pointer() != pointer) || (e.Path == nil && pointer != "") {
+		t.Fatalf("Expected the %s limit at %q got %v", limit, pointer, e)
+	}
+}
+
+func TestLimits_input(t *testing.T) {
+	jsonText := `{"a": "abc"}`
+	options := Options{FilterRunner: commandFilterRunner, Limits: Limits{Input: int64(len(jsonText)) - 1}}
+
+	_,err := FilterJsonFromTextWithOptions(jsonText, "upper", options)
+	expectLimitError(t, err, LimitInput, "")
+	_,err = FilterJsonFromReaderWithOptions(strings.NewReader(jsonText), "upper", options)
+	expectLimitError(t, err, LimitInput, "")
+	_,err = FilterBytesWithOptions([]byte(jsonText), "upper", options)
+	expectLimitError(t, err, LimitInput, "")
+
+	options.Limits.Input++
+	if _,err = FilterJsonFromReaderWithOptions(strings.NewReader(jsonText), "upper", options); err != nil {
+		t.Fatalf("Expected input as large as the limit to pass :: %v", err.Error())
+	}
+}
+
+func TestLimits_depth(t *testing.T) {
+	jsonText := `{"a": {"b": ["c"]}, "d": "e"}`
+	options := Options{FilterRunner: commandFilterRunner, Limits: Limits{Depth: 2}}
+
+	_,err := FilterJsonFromTextWithOptions(jsonText, "upper", options)
+	expectLimitError(t, err, LimitDepth, "/a/b")
+	_,err = FilterBytesWithOptions([]byte(jsonText), "upper", options)
+	expectLimitError(t, err, LimitDepth, "/a/b")
+
+	options.Limits.Depth = 3
+	if _,err = FilterBytesWithOptions([]byte(jsonText), "upper", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+}
+
+func TestLimits_output(t *testing.T) {
+	jsonText := `{"a": "abc", "b": "def"}`
+
+	options := Options{FilterRunner: commandFilterRunner, Limits: Limits{FilterOutput: 5}}
+	_,err := FilterJsonFromTextWithOptions(jsonText, "f", options)
+	expectLimitError(t, err, LimitFilterOutput, "/a")
+
+	options.Limits = Limits{Output: 10}
+	_,err = FilterBytesWithOptions([]byte(jsonText), "f", options)
+	expectLimitError(t, err, LimitOutput, "/b")
+
+	options.Limits = Limits{FilterOutput: 6, Output: 12}
+	if _,err = FilterBytesWithOptions([]byte(jsonText), "f", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+}
+
+func TestLimits_commandOutput(t *testing.T) {
+	options := Options{Limits: Limits{FilterOutput: 1000}}
+
+	_,err := commandLineFilterRunner("yes", "", options)
+	expectLimitError(t, err, LimitFilterOutput, "")
+}
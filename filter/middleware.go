@@ -0,0 +1,151 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "bytes"
+  "fmt"
+  "io/ioutil"
+  "log"
+  "mime"
+  "net/http"
+  "strconv"
+  "strings"
+)
+
+// Handler returns a handler that filters the JSON response bodies written by next with f.
+// Responses are buffered and only filtered when their Content-Type is application/json or ends
+// in "+json", every other response passes through untouched. A JSON response that cannot be
+// filtered, such as one with a Content-Encoding, is replaced by a 500 Internal Server Error so
+// that unfiltered data never leaks, and the reason is logged with the standard logger. A JSON
+// response is only buffered up to the input size limit of f, see Limits.
+func Handler(next http.Handler, f *Filter) http.Handler {
+  return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+    fw := &filterResponseWriter{ResponseWriter: w, filter: f}
+    next.ServeHTTP(fw, r)
+    fw.finish()
+  })
+}
+
+// RequestHandler returns a handler that filters JSON request bodies with f before passing the
+// request to next. Requests whose Content-Type is not JSON are passed through untouched. A JSON
+// request that cannot be filtered is rejected with a 400 Bad Request, or a 413 Request Entity Too
+// Large when it exceeds the input size limit of f.
+func RequestHandler(next http.Handler, f *Filter) http.Handler {
+  return http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+    if r.Body == nil || !IsJSONContentType(r.Header.Get("Content-Type")) {
+      next.ServeHTTP(w, r)
+      return
+    }
+
+    data,err := ioutil.ReadAll(f.options.Limits.Reader(r.Body))
+    r.Body.Close()
+    if err == nil {
+      if err = checkContentEncoding(r.Header); err == nil {
+        data,err = f.Bytes(data)
+      }
+    }
+    if err != nil {
+      status := http.StatusBadRequest
+      if e,ok := err.(*LimitError); ok && e.Limit == LimitInput {
+        status = http.StatusRequestEntityTooLarge
+      }
+      http.Error(w, fmt.Sprintf("Failed to filter JSON request :: %v", err), status)
+      return
+    }
+
+    r.Body = ioutil.NopCloser(bytes.NewReader(data))
+    r.ContentLength = int64(len(data))
+    r.Header.Set("Content-Length", strconv.Itoa(len(data)))
+    next.ServeHTTP(w, r)
+  })
+}
+
+// IsJSONContentType reports whether a Content-Type header value is application/json or a
+// structured syntax suffix type ending in "+json".
+func IsJSONContentType(contentType string) bool {
+  mediaType,_,err := mime.ParseMediaType(contentType)
+  return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+func checkContentEncoding(header http.Header) error {
+  if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+    return fmt.Errorf("Cannot filter JSON with Content-Encoding '%s'", encoding)
+  }
+  return nil
+}
+
+// filterResponseWriter buffers JSON responses until finish is called and passes every other
+// response straight through.
+type filterResponseWriter struct {
+  http.ResponseWriter
+  filter *Filter
+  status int
+  buffer *outputBuffer
+  wroteHeader bool
+}
+
+func (w *filterResponseWriter) WriteHeader(status int) {
+  if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+    // Informational responses such as 103 Early Hints come before the final status, which
+    // decides if the response is buffered.
+    w.ResponseWriter.WriteHeader(status)
+    return
+  } else if w.wroteHeader {
+    return
+  }
+  w.wroteHeader = true
+  w.status = status
+
+  if status != http.StatusNoContent && status != http.StatusNotModified && IsJSONContentType(w.Header().Get("Content-Type")) {
+    w.buffer = &outputBuffer{max: w.filter.options.Limits.Input}
+  } else {
+    w.ResponseWriter.WriteHeader(status)
+  }
+}
+
+func (w *filterResponseWriter) Write(b []byte) (int, error) {
+  if !w.wroteHeader {
+    w.WriteHeader(http.StatusOK)
+  }
+  if w.buffer != nil {
+    return w.buffer.Write(b)
+  }
+  return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes responses that are passed through. Buffered responses are only written by finish.
+func (w *filterResponseWriter) Flush() {
+  if flusher,ok := w.ResponseWriter.(http.Flusher); ok && w.buffer == nil {
+    flusher.Flush()
+  }
+}
+
+func (w *filterResponseWriter) finish() {
+  if w.buffer == nil {
+    return
+  }
+
+  header := w.Header()
+  data,err := w.buffer.Bytes(),checkContentEncoding(header)
+  if w.buffer.exceeded {
+    err = &LimitError{Limit: LimitInput, Max: w.buffer.max}
+  }
+  if err == nil {
+    data,err = w.filter.Bytes(data)
+  }
+
+  if err != nil {
+    log.Printf("Failed to filter JSON response :: %v", err)
+    header.Del("Content-Encoding")
+    header.Del("Content-Length")
+    http.Error(w.ResponseWriter, "Failed to filter JSON response", http.StatusInternalServerError)
+    return
+  }
+
+  header.Set("Content-Length", strconv.Itoa(len(data)))
+  w.ResponseWriter.WriteHeader(w.status)
+  w.ResponseWriter.Write(data)
+}
@@ -0,0 +1,156 @@
+package filter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func compileUpper(t *testing.T) *Filter {
+	f,err := Compile("./fixtures/object-filter.json", Options{FilterRunner: upperFilterRunner})
+	if err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+	return f
+}
+
+func TestHandler_filtersJsonResponses(t *testing.T) {
+	next := http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Content-Length", "20")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"a": "x", "c": "y"}`))
+	})
+	recorder := httptest.NewRecorder()
+	Handler(next, compileUpper(t)).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 got %v", recorder.Code)
+	}
+	if body := recorder.Body.String(); body != `{"a":"X","c":"y"}` {
+		t.Fatalf("Unexpected body :: %v", body)
+	}
+	if length := recorder.Header().Get("Content-Length"); length != "17" {
+		t.Fatalf("Expected Content-Length to be updated got %v", length)
+	}
+}
+
+func TestHandler_informationalResponses(t *testing.T) {
+	next := http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"a": "secret"}`))
+	})
+	server := httptest.NewServer(Handler(next, compileUpper(t)))
+	defer server.Close()
+
+	response,err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+	defer response.Body.Close()
+
+	if body,_ := ioutil.ReadAll(response.Body); response.StatusCode != http.StatusOK || string(body) != `{"a":"SECRET"}` {
+		t.Fatalf("Expected the response after 103 Early Hints to be filtered got %v %s", response.StatusCode, body)
+	}
+}
+
+func TestHandler_passesThroughOtherResponses(t *testing.T) {
+	next := http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(`{"a": "x"}`))
+	})
+	recorder := httptest.NewRecorder()
+	Handler(next, compileUpper(t)).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	if body := recorder.Body.String(); body != `{"a": "x"}` {
+		t.Fatalf("Unexpected body :: %v", body)
+	}
+}
+
+func TestHandler_failsClosed(t *testing.T) {
+	next := http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte(`{"a": "secret"}`))
+	})
+	recorder := httptest.NewRecorder()
+	Handler(next, compileUpper(t)).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500 got %v", recorder.Code)
+	}
+	if strings.Contains(recorder.Body.String(), "secret") {
+		t.Fatalf("Expected the unfiltered body to be discarded")
+	}
+}
+
+func TestRequestHandler(t *testing.T) {
+	var body string
+	next := http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		b,_ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	})
+	request := httptest.NewRequest("POST", "/", strings.NewReader(`{"b": "quiet", "c": "x"}`))
+	request.Header.Set("Content-Type", "application/json")
+	RequestHandler(next, compileUpper(t)).ServeHTTP(httptest.NewRecorder(), request)
+
+	if body != `{"b":"QUIET","c":"x"}` {
+		t.Fatalf("Unexpected body :: %v", body)
+	}
+
+	recorder := httptest.NewRecorder()
+	request = httptest.NewRequest("POST", "/", strings.NewReader(`{"b": `))
+	request.Header.Set("Content-Type", "application/json")
+	RequestHandler(next, compileUpper(t)).ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 got %v", recorder.Code)
+	}
+}
+
+// endlessReader reads whitespace forever.
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for k := range p {
+		p[k] = ' '
+	}
+	return len(p),nil
+}
+
+func TestHandler_inputLimit(t *testing.T) {
+	f,err := Compile("./fixtures/object-filter.json", Options{FilterRunner: upperFilterRunner, Limits: Limits{Input: 1024}})
+	if err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+
+	writes := 0
+	next := http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		for ; writes < 100000; writes++ {
+			if _,err := w.Write([]byte(strings.Repeat(" ", 100))); err != nil {
+				break
+			}
+		}
+	})
+	recorder := httptest.NewRecorder()
+	Handler(next, f).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	if recorder.Code != http.StatusInternalServerError || writes > 10 {
+		t.Fatalf("Expected the response to stop being buffered at the limit got status %v after %v writes", recorder.Code, writes)
+	}
+
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest("POST", "/", endlessReader{})
+	request.Header.Set("Content-Type", "application/json")
+	RequestHandler(next, f).ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status 413 got %v", recorder.Code)
+	}
+}
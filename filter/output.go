@@ -0,0 +1,129 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "encoding/json"
+  "fmt"
+  "math"
+  "strconv"
+  "strings"
+)
+
+// OutputMode determines how the output of a filter is turned into the JSON value that replaces
+// the filtered string.
+type OutputMode string
+
+const (
+  // OutputString keeps the output as a string. This is the default.
+  OutputString OutputMode = "string"
+  // OutputJSON parses the output as a JSON value of any type.
+  OutputJSON OutputMode = "json"
+  // OutputNumber parses the output as a number.
+  OutputNumber OutputMode = "number"
+  // OutputBool parses the output as a boolean, i.e. "true", "false", "1" or "0".
+  OutputBool OutputMode = "bool"
+  // OutputAuto parses the output as a JSON value when it is one and keeps it as a string otherwise.
+  OutputAuto OutputMode = "auto"
+)
+
+const (
+  // commandSection holds the command of a command rule, an object used instead of a command
+  // string to configure how the command is applied.
+  commandSection = "$command"
+  // outputSection holds the output mode of a command rule.
+  outputSection = "$output"
+)
+
+// ParseOutputMode converts the name of an output mode to an OutputMode. The empty string is
+// OutputString.
+func ParseOutputMode(name string) (OutputMode, error) {
+  switch mode := OutputMode(name); mode {
+  case "": return OutputString,nil
+  case OutputString, OutputJSON, OutputNumber, OutputBool, OutputAuto: return mode,nil
+  }
+  return "",fmt.Errorf("Unknown output mode '%s', expected one of string, json, number, bool or auto", name)
+}
+
+// isCommandRule determines if a rule is a command rule rather than an object of rules.
+func isCommandRule(rule interface{}) bool {
+  m,ok := rule.(map[string]interface{})
+  if ok {
+    _,ok = m[commandSection]
+  }
+  return ok
+}
+
+// ruleCommand returns the command and output mode of a command string or command rule.
+func ruleCommand(rule interface{}) (command string, mode OutputMode, ok bool) {
+  mode = OutputString
+  switch r := rule.(type) {
+  case string:
+    command,ok = r,true
+  case map[string]interface{}:
+    if command,ok = r[commandSection].(string); ok {
+      if name,isString := r[outputSection].(string); isString {
+        mode,_ = ParseOutputMode(name)
+      }
+    }
+  }
+  return
+}
+
+// parseOutput converts the output of a filter to a JSON value according to an output mode.
+// Surrounding whitespace is ignored by every mode but OutputString.
+func parseOutput(output string, mode OutputMode) (interface{}, error) {
+  trimmed := strings.TrimSpace(output)
+
+  switch mode {
+  case OutputJSON, OutputAuto:
+    var value interface{}
+    if err := json.Unmarshal([]byte(trimmed), &value); err != nil {
+      if mode == OutputAuto {
+        return output,nil
+      }
+      return nil,fmt.Errorf("Expected JSON output :: %v", err)
+    }
+    return value,nil
+  case OutputNumber:
+    n,err := strconv.ParseFloat(trimmed, 64)
+    if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+      return nil,fmt.Errorf("Expected a number, got '%s'", trimmed)
+    }
+    return n,nil
+  case OutputBool:
+    switch trimmed {
+    case "true", "1": return true,nil
+    case "false", "0": return false,nil
+    }
+    return nil,fmt.Errorf("Expected true, false, 1 or 0, got '%s'", trimmed)
+  }
+  return output,nil
+}
+
+func validateCommandRule(m map[string]interface{}, path Path, errs *ValidationErrors) {
+  fail := func (path Path, format string, args ...interface{}) {
+    *errs = append(*errs, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+  }
+
+  for _,k := range sortedKeys(m) {
+    switch k {
+    case commandSection:
+      if _,ok := m[k].(string); ok {
+        validateRule(m[k], path.Append(Key(k)), errs)
+      } else {
+        fail(path.Append(Key(k)), "expected a command, got %s", jsonTypeName(m[k]))
+      }
+    case outputSection:
+      if name,ok := m[k].(string); !ok {
+        fail(path.Append(Key(k)), "expected an output mode, got %s", jsonTypeName(m[k]))
+      } else if _,err := ParseOutputMode(name); err != nil {
+        fail(path.Append(Key(k)), "%s", err.Error())
+      }
+    default:
+      fail(path.Append(Key(k)), "a command rule cannot have other keys, expected %s or %s", commandSection, outputSection)
+    }
+  }
+}
@@ -0,0 +1,99 @@
+package filter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const outputJson = `{"count": "forty-two", "enabled": "yes", "meta": "a,b", "note": "n", "name": "darren"}`
+
+func outputFilterRunner(command string, value string) (string, error) {
+	switch command {
+	case "count":
+		return "42\n",nil
+	case "flag":
+		return "true",nil
+	case "meta":
+		return `{"tags": ["` + strings.Replace(value, ",", `","`, -1) + `"]}`,nil
+	case "note":
+		return "plain " + value,nil
+	}
+	return strings.ToUpper(value),nil
+}
+
+func TestOutputMode_filters(t *testing.T) {
+	expectedJson := `{"count":42,"enabled":true,"meta":{"tags":["a","b"]},"name":"DARREN","note":"plain n"}`
+	options := Options{FilterRunner: outputFilterRunner, Strict: true}
+
+	if value,err := FilterJsonFromTextWithOptions(outputJson, "./fixtures/output-filter.json", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if b,_ := json.Marshal(value); string(b) != expectedJson {
+		t.Fatalf("Expected %v got %v", expectedJson, string(b))
+	}
+
+	expectedJson = `{"count":42,"enabled":true,"meta":{"tags":["a","b"]},"note":"plain n","name":"DARREN"}`
+	if data,err := FilterBytesWithOptions([]byte(outputJson), "./fixtures/output-filter.json", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if string(data) != expectedJson {
+		t.Fatalf("Expected %v got %v", expectedJson, string(data))
+	}
+}
+
+func TestOutputMode_invalidOutput(t *testing.T) {
+	options := Options{FilterRunner: func(command string, value string) (string, error) { return "many",nil }}
+
+	_,err := FilterJsonFromTextWithOptions(`{"count": "x"}`, "./fixtures/output-filter.json", options)
+	if e,ok := err.(*FilterError); !ok || e.Path.Pointer() != "/count" {
+		t.Fatalf("Expected a FilterError at /count got %v", err)
+	}
+}
+
+func TestOutputMode_bool(t *testing.T) {
+	for output,expected := range map[string]bool{"true": true, " 1\n": true, "false": false, "0": false} {
+		if value,err := parseOutput(output, OutputBool); err != nil || value != expected {
+			t.Fatalf("Expected '%v' to parse as %v got %v, %v", output, expected, value, err)
+		}
+	}
+	for _,output := range []string{"t", "T", "TRUE", "True", "F", "yes"} {
+		if _,err := parseOutput(output, OutputBool); err == nil {
+			t.Fatalf("Expected '%v' not to parse as a boolean", output)
+		}
+	}
+}
+
+func TestOutputMode_typed(t *testing.T) {
+	type document struct {
+		Count interface{} `json:"count"`
+		Name  string      `json:"name"`
+	}
+	options := Options{FilterRunner: outputFilterRunner}
+
+	doc := &document{Count: "forty-two", Name: "darren"}
+	if _,err := FilterValueWithOptions(doc, "./fixtures/output-filter.json", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if doc.Count != 42.0 || doc.Name != "DARREN" {
+		t.Fatalf("Expected the count to be a number got %#v", doc)
+	}
+
+	withNumber := &struct {
+		Count string `json:"count"`
+	}{"forty-two"}
+	if _,err := FilterValueWithOptions(withNumber, "./fixtures/output-filter.json", options); err == nil {
+		t.Fatalf("Expected an error setting a number to a string field")
+	}
+}
+
+func TestOutputMode_validation(t *testing.T) {
+	filters := map[string]interface{}{
+		"a": map[string]interface{}{"$command": 1.0},
+		"b": map[string]interface{}{"$command": "x", "$output": "float"},
+		"c": map[string]interface{}{"$command": "x", "d": "y"},
+		"$default": map[string]interface{}{"$command": "x", "$output": "json"},
+	}
+
+	errs,ok := ValidateFilters(filters).(ValidationErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("Expected 3 validation errors got %v", errs)
+	}
+}
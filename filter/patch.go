@@ -0,0 +1,89 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "io"
+  "encoding/json"
+)
+
+// Operation is a single RFC 6902 JSON Patch operation. Path is an RFC 6901 JSON Pointer
+// to the value being modified. Value is ignored for "remove" operations.
+type Operation struct {
+  Op string
+  Path string
+  Value interface{}
+}
+
+// Patch is an RFC 6902 JSON Patch describing the modifications made by a filter.
+type Patch []Operation
+
+// MarshalJSON encodes the operation as an RFC 6902 operation object. The value member
+// is omitted for "remove" operations.
+func (op Operation) MarshalJSON() ([]byte, error) {
+  if op.Op == "remove" {
+    return json.Marshal(struct {
+      Op string `json:"op"`
+      Path string `json:"path"`
+    }{op.Op, op.Path})
+  }
+
+  return json.Marshal(struct {
+    Op string `json:"op"`
+    Path string `json:"path"`
+    Value interface{} `json:"value"`
+  }{op.Op, op.Path, op.Value})
+}
+
+// PatchJsonFromText filters JSON data from text and returns the filtered JSON data alongside a
+// JSON Patch containing an operation for each string value that was modified by a filter.
+// See FilterJsonFromText for details on the filter argument.
+func PatchJsonFromText(jsonText string, filter string) (value interface{}, patch Patch, err error) {
+  return PatchJsonFromTextWithOptions(jsonText, filter, Options{})
+}
+
+// PatchJsonFromTextWithFilterRunner filters JSON data from text using a custom filter runner and returns the
+// filtered JSON data alongside a JSON Patch containing an operation for each string value that was modified
+// by a filter. See FilterJsonFromText for details on the filter argument.
+func PatchJsonFromTextWithFilterRunner(jsonText string, filter string, filterRunner FilterRunner) (value interface{}, patch Patch, err error) {
+  return PatchJsonFromTextWithOptions(jsonText, filter, Options{FilterRunner: filterRunner})
+}
+
+// PatchJsonFromTextWithOptions filters JSON data from text using the specified options and returns the
+// filtered JSON data alongside a JSON Patch containing an operation for each string value that was modified
+// by a filter. See FilterJsonFromText for details on the filter argument.
+func PatchJsonFromTextWithOptions(jsonText string, filter string, options Options) (value interface{}, patch Patch, err error) {
+  if err = options.Limits.checkInput(len(jsonText)); err != nil {
+    return
+  }
+  if value,err = readJsonFromText(jsonText); err == nil {
+    value,patch,err = doFilter(value, filter, options)
+  }
+  return
+}
+
+// PatchJsonFromReader filters JSON data from a reader and returns the filtered JSON data alongside a
+// JSON Patch containing an operation for each string value that was modified by a filter.
+// See FilterJsonFromText for details on the filter argument.
+func PatchJsonFromReader(reader io.Reader, filter string) (value interface{}, patch Patch, err error) {
+  return PatchJsonFromReaderWithOptions(reader, filter, Options{})
+}
+
+// PatchJsonFromReaderWithFilterRunner filters JSON data from a reader using a custom filter runner and returns the
+// filtered JSON data alongside a JSON Patch containing an operation for each string value that was modified
+// by a filter. See FilterJsonFromText for details on the filter argument.
+func PatchJsonFromReaderWithFilterRunner(reader io.Reader, filter string, filterRunner FilterRunner) (value interface{}, patch Patch, err error) {
+  return PatchJsonFromReaderWithOptions(reader, filter, Options{FilterRunner: filterRunner})
+}
+
+// PatchJsonFromReaderWithOptions filters JSON data from a reader using the specified options and returns the
+// filtered JSON data alongside a JSON Patch containing an operation for each string value that was modified
+// by a filter. See FilterJsonFromText for details on the filter argument.
+func PatchJsonFromReaderWithOptions(reader io.Reader, filter string, options Options) (value interface{}, patch Patch, err error) {
+  if value,err = readJsonFromReader(options.Limits.Reader(reader)); err == nil {
+    value,patch,err = doFilter(value, filter, options)
+  }
+  return
+}
@@ -0,0 +1,52 @@
+package filter
+
+import (
+	"testing"
+	"os"
+	"strings"
+	"encoding/json"
+)
+
+func TestPatchJsonFromReader_replaceOperations(t *testing.T) {
+	expectedPatch := `[{"op":"replace","path":"/a","value":"HELLO WORLD!"},{"op":"replace","path":"/b/c","value":"this is a line of text"},{"op":"replace","path":"/b/d/0","value":"This Is Some Text"},{"op":"replace","path":"/b/d/1","value":"--So is this--"}]`
+
+	if file,err := os.Open("./fixtures/dataset-1.json"); err == nil {
+		filterRunner := func(command string, value string) (string, error) {
+			switch command {
+			case "upper": return strings.ToUpper(value),nil
+			case "lower": return strings.ToLower(value),nil
+			case "title": return strings.Title(value),nil
+			case "custom": return "--" + value + "--",nil
+			default: t.Fatalf("Unexpected command :: %v", command)
+			}
+			return value,nil
+		}
+		if _,patch,err := PatchJsonFromReaderWithFilterRunner(file, "./fixtures/filters.json", filterRunner); err != nil {
+			t.Fatalf("Expected no error :: %v", err.Error())
+		} else if b,err := json.Marshal(patch); err != nil {
+			t.Fatalf("Expected patch to marshal :: %v", err.Error())
+		} else if string(b) != expectedPatch {
+			t.Fatalf("Expected patch to be '%v' got '%v'", expectedPatch, string(b))
+		}
+	} else {
+		t.Fatalf("Failed to open fixture :: %v", err.Error())
+	}
+}
+
+func TestPatchJsonFromText_unchangedValuesAndEscaping(t *testing.T) {
+	expectedPatch := `[{"op":"replace","path":"/a~1b/m~0n","value":""}]`
+	filterRunner := func(command string, value string) (string, error) {
+		if value == "drop" {
+			return "",nil
+		}
+		return value,nil
+	}
+
+	if _,patch,err := PatchJsonFromTextWithFilterRunner(`{"a/b": {"m~n": "drop", "keep": "keep"}}`, "any", filterRunner); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if b,err := json.Marshal(patch); err != nil {
+		t.Fatalf("Expected patch to marshal :: %v", err.Error())
+	} else if string(b) != expectedPatch {
+		t.Fatalf("Expected patch to be '%v' got '%v'", expectedPatch, string(b))
+	}
+}
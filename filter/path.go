@@ -0,0 +1,125 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "bytes"
+  "strconv"
+  "strings"
+)
+
+// PathElement is a single step in a Path. It is either an object key or an array index.
+// Len is the length of the array an index belongs to when known, otherwise 0.
+type PathElement struct {
+  Key string
+  Index int
+  IsIndex bool
+  Len int
+}
+
+// Path is the location of a value within JSON data, starting from the root.
+type Path []PathElement
+
+// Key returns a PathElement for an object key.
+func Key(key string) PathElement {
+  return PathElement{Key: key}
+}
+
+// Index returns a PathElement for an array index.
+func Index(index int) PathElement {
+  return PathElement{Index: index, IsIndex: true}
+}
+
+// arrayIndex returns a PathElement for an index of an array of known length.
+func arrayIndex(index int, length int) PathElement {
+  return PathElement{Index: index, IsIndex: true, Len: length}
+}
+
+// Append returns a new path with elem appended. The receiver is never modified.
+func (p Path) Append(elem PathElement) Path {
+  path := make(Path, len(p), len(p) + 1)
+  copy(path, p)
+  return append(path, elem)
+}
+
+// Pointer returns the path as an RFC 6901 JSON Pointer, i.e. "/a/0/b".
+// The root path is the empty string.
+func (p Path) Pointer() string {
+  var buf bytes.Buffer
+
+  for _,elem := range p {
+    buf.WriteByte('/')
+    if elem.IsIndex {
+      buf.WriteString(strconv.Itoa(elem.Index))
+    } else {
+      buf.WriteString(escapePointerToken(elem.Key))
+    }
+  }
+
+  return buf.String()
+}
+
+// JSONPath returns the path as a normalized JSONPath expression, i.e. "$.a[0]['b c']".
+// Keys that are not plain identifiers are written with bracket notation.
+func (p Path) JSONPath() string {
+  return p.jsonPath(false)
+}
+
+// Pattern returns the path as a JSONPath expression with every array index replaced
+// by the "[*]" wildcard, i.e. "$.a[*].b". Values found in different items of the same
+// array share a pattern.
+func (p Path) Pattern() string {
+  return p.jsonPath(true)
+}
+
+func (p Path) jsonPath(collapseIndices bool) string {
+  var buf bytes.Buffer
+
+  buf.WriteByte('$')
+  for _,elem := range p {
+    if elem.IsIndex && collapseIndices {
+      buf.WriteString("[*]")
+    } else if elem.IsIndex {
+      buf.WriteByte('[')
+      buf.WriteString(strconv.Itoa(elem.Index))
+      buf.WriteByte(']')
+    } else if isIdentifier(elem.Key) {
+      buf.WriteByte('.')
+      buf.WriteString(elem.Key)
+    } else {
+      buf.WriteString("['")
+      buf.WriteString(strings.Replace(strings.Replace(elem.Key, `\`, `\\`, -1), "'", `\'`, -1))
+      buf.WriteString("']")
+    }
+  }
+
+  return buf.String()
+}
+
+// String returns the path as a JSONPath expression.
+func (p Path) String() string {
+  return p.JSONPath()
+}
+
+func isIdentifier(key string) bool {
+  if len(key) == 0 {
+    return false
+  }
+
+  for i,r := range key {
+    if r == '_' || r == '$' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+      continue
+    } else if i > 0 && r >= '0' && r <= '9' {
+      continue
+    }
+    return false
+  }
+
+  return true
+}
+
+func escapePointerToken(token string) string {
+  return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
@@ -0,0 +1,74 @@
+package filter
+
+import (
+	"testing"
+	"errors"
+	"strings"
+)
+
+func TestPath_pointerAndJSONPath(t *testing.T) {
+	path := Path{Key("a"), Index(0), Key("b c"), Key("it's"), Key("x/y~z")}
+
+	if p := path.Pointer(); p != "/a/0/b c/it's/x~1y~0z" {
+		t.Fatalf("Unexpected pointer :: %v", p)
+	}
+	if p := path.JSONPath(); p != `$.a[0]['b c']['it\'s']['x/y~z']` {
+		t.Fatalf("Unexpected JSONPath :: %v", p)
+	}
+	if p := path.Pattern(); p != `$.a[*]['b c']['it\'s']['x/y~z']` {
+		t.Fatalf("Unexpected pattern :: %v", p)
+	}
+	if p := (Path{}).Pointer(); p != "" {
+		t.Fatalf("Expected root pointer to be empty got '%v'", p)
+	}
+}
+
+func TestPath_appendDoesNotAlias(t *testing.T) {
+	base := make(Path, 0, 4).Append(Key("a"))
+	first := base.Append(Key("b"))
+	second := base.Append(Key("c"))
+
+	if first.Pointer() != "/a/b" || second.Pointer() != "/a/c" {
+		t.Fatalf("Expected appended paths to be independent got '%v' and '%v'", first, second)
+	}
+}
+
+func TestFilterJsonFromText_specialCharacterKeys(t *testing.T) {
+	var (
+		expectedJson = map[string]interface{}{
+			"it's [a] key": map[string]interface{}{
+				"a/b": "HELLO",
+				"c": "world",
+			},
+		}
+	)
+
+	filterRunner := func(path Path, command string, value string) (string, error) {
+		if command != "upper" {
+			t.Fatalf("Unexpected command :: %v", command)
+		}
+		if path.Pointer() != "/it's [a] key/a~1b" {
+			t.Fatalf("Unexpected path :: %v", path.Pointer())
+		}
+		return strings.ToUpper(value),nil
+	}
+
+	if value,err := FilterJsonFromTextWithOptions(`{"it's [a] key": {"a/b": "hello", "c": "world"}}`, "./fixtures/special-keys-filter.json", Options{PathFilterRunner: filterRunner}); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else {
+		testValue(value, expectedJson, t)
+	}
+}
+
+func TestFilterJsonFromText_filterErrorHasPath(t *testing.T) {
+	filterRunner := func(command string, value string) (string, error) {
+		return "",errors.New("boom")
+	}
+
+	_,err := FilterJsonFromTextWithFilterRunner(`{"a": [1, "x"]}`, "fail", filterRunner)
+	if filterErr,ok := err.(*FilterError); !ok {
+		t.Fatalf("Expected a FilterError got %v", err)
+	} else if filterErr.Path.JSONPath() != "$.a[1]" || filterErr.Command != "fail" {
+		t.Fatalf("Unexpected FilterError :: %v", filterErr)
+	}
+}
@@ -0,0 +1,52 @@
+package filter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPrecedence_wildcardAndDefaultRules(t *testing.T) {
+	jsonText := `{"user": {"password": "p", "email": "e", "friend": {"name": "n", "age": "a"}}, "items": [{"sku": "s", "note": "n"}], "other": "o"}`
+	expectedJson := `{"items":[{"note":"item(n)","sku":"sku(s)"}],"other":"base(o)","user":{"email":"user(e)","friend":{"age":"user(a)","name":"anyname(n)"},"password":"secret(p)"}}`
+	options := Options{FilterRunner: commandFilterRunner, Strict: true}
+
+	if value,err := FilterJsonFromTextWithOptions(jsonText, "./fixtures/precedence-filter.json", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if b,_ := json.Marshal(value); string(b) != expectedJson {
+		t.Fatalf("Expected %v got %v", expectedJson, string(b))
+	}
+}
+
+func TestPrecedence_exactKeyBeforeWildcard(t *testing.T) {
+	filters := map[string]interface{}{
+		"a": map[string]interface{}{"x": "exact", "*": "wildcard"},
+		"b": map[string]interface{}{"$default": "fallback", "c": map[string]interface{}{"d": "deep"}, "*": map[string]interface{}{"e": "wide"}},
+	}
+	tests := []struct {
+		path Path
+		command string
+	}{
+		{Path{Key("a"), Key("x")}, "exact"},
+		{Path{Key("a"), Key("y")}, "wildcard"},
+		{Path{Key("b"), Key("c"), Key("d")}, "deep"},
+		{Path{Key("b"), Key("c"), Key("e")}, "wide"},
+		{Path{Key("b"), Key("c"), Key("f")}, "fallback"},
+	}
+
+	for _,test := range tests {
+		if command,_,found := getFilterCommand(test.path, filters); !found || command != test.command {
+			t.Fatalf("Expected %v at %v got %v", test.command, test.path, command)
+		}
+	}
+}
+
+func TestPrecedence_defaultMustBeACommand(t *testing.T) {
+	filters := map[string]interface{}{
+		"a": map[string]interface{}{"$default": map[string]interface{}{"b": "x"}},
+		"c": map[string]interface{}{"$array": map[string]interface{}{"$default": map[string]interface{}{"d": "x"}}},
+	}
+
+	if errs,ok := ValidateFilters(filters).(ValidationErrors); !ok || len(errs) != 1 {
+		t.Fatalf("Expected 1 validation error got %v", errs)
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "errors"
+  "fmt"
+  "path/filepath"
+  "strings"
+)
+
+const (
+  includeSection = "$include"
+  profilesSection = "$profiles"
+  extendsSection = "$extends"
+)
+
+// Includes returns the path of a filter file followed by the path of every filter file it
+// includes, directly or not. Returns nil when filter is a command.
+func Includes(filter string) ([]string, error) {
+  if !isFilterFile(filter) {
+    return nil,nil
+  } else if _,ok,err := readSchemaFile(filter); err != nil || ok {
+    return []string{filter},err
+  }
+
+  files := []string{}
+  _,err := readFilterFile(filter, map[string]bool{}, &files)
+  return files,err
+}
+
+// Profiles returns the names of the profiles declared in a filter file and the files it includes,
+// sorted.
+func Profiles(filter string) ([]string, error) {
+  if !isFilterFile(filter) {
+    return []string{},nil
+  } else if _,ok,err := readSchemaFile(filter); err != nil || ok {
+    return []string{},err
+  }
+
+  filters,err := readFilterFile(filter, map[string]bool{}, nil)
+  if err != nil {
+    return nil,err
+  }
+
+  names := []string{}
+  if m,ok := filters.(map[string]interface{}); ok {
+    if profiles,ok := m[profilesSection].(map[string]interface{}); ok {
+      names = sortedKeys(profiles)
+    }
+  }
+  return names,nil
+}
+
+// loadFilterFile reads a filter file with its includes and returns the rules of the profile
+// with the specified name, or the top-level rules when name is empty.
+func loadFilterFile(filter string, name string) (interface{}, error) {
+  filters,err := readFilterFile(filter, map[string]bool{}, nil)
+  if err != nil {
+    return nil,err
+  }
+
+  return selectProfile(filters, name)
+}
+
+// readFilterFile reads and validates a filter file, then merges it over the files listed in its
+// "$include" section, in order. Included paths are relative to the including file. Visiting holds
+// the files being read to detect include cycles and files collects every file read when not nil.
+func readFilterFile(fileName string, visiting map[string]bool, files *[]string) (interface{}, error) {
+  abs,err := filepath.Abs(fileName)
+  if err != nil {
+    return nil,err
+  } else if visiting[abs] {
+    return nil,fmt.Errorf("Filter file '%s' includes itself", fileName)
+  }
+  visiting[abs] = true
+  defer delete(visiting, abs)
+
+  if files != nil {
+    *files = append(*files, fileName)
+  }
+
+  value,err := readJsonFromFile(fileName)
+  if err != nil {
+    return nil,err
+  } else if err = ValidateFilters(value); err != nil {
+    return nil,err
+  }
+
+  m,ok := value.(map[string]interface{})
+  if !ok {
+    return value,nil
+  }
+
+  var merged interface{} = map[string]interface{}{}
+  if includes,ok := m[includeSection].([]interface{}); ok {
+    for _,include := range includes {
+      included,err := readFilterFile(filepath.Join(filepath.Dir(fileName), include.(string)), visiting, files)
+      if err != nil {
+        return nil,fmt.Errorf("Failed to include '%s' :: %v", include, err)
+      } else if _,ok := included.(map[string]interface{}); !ok {
+        return nil,fmt.Errorf("Failed to include '%s' :: expected an object of rules", include)
+      }
+      merged = mergeRules(merged, included)
+    }
+  }
+
+  own := map[string]interface{}{}
+  for k,v := range m {
+    if k != includeSection {
+      own[k] = v
+    }
+  }
+
+  return mergeRules(merged, own),nil
+}
+
+// selectProfile returns the top-level rules of filters merged with the rules of the named profile
+// and every profile it extends. The "$profiles" section is removed.
+func selectProfile(filters interface{}, name string) (interface{}, error) {
+  m,ok := filters.(map[string]interface{})
+  if !ok && name == "" {
+    return filters,nil
+  }
+
+  base := map[string]interface{}{}
+  for k,v := range m {
+    if k != profilesSection {
+      base[k] = v
+    }
+  }
+
+  if name == "" {
+    return base,nil
+  }
+
+  profiles,_ := m[profilesSection].(map[string]interface{})
+  profile,err := resolveProfile(profiles, name, map[string]bool{})
+  if err != nil {
+    return nil,err
+  }
+
+  return mergeRules(base, profile),nil
+}
+
+func resolveProfile(profiles map[string]interface{}, name string, visiting map[string]bool) (map[string]interface{}, error) {
+  p,ok := profiles[name].(map[string]interface{})
+  if !ok {
+    names := []string{}
+    if profiles != nil {
+      names = sortedKeys(profiles)
+    }
+    return nil,fmt.Errorf("Unknown profile '%s', expected one of %v", name, names)
+  } else if visiting[name] {
+    return nil,fmt.Errorf("Profile '%s' extends itself", name)
+  }
+  visiting[name] = true
+  defer delete(visiting, name)
+
+  merged := map[string]interface{}{}
+  for _,parent := range profileExtends(p) {
+    resolved,err := resolveProfile(profiles, parent, visiting)
+    if err != nil {
+      return nil,err
+    }
+    merged = mergeRules(merged, resolved).(map[string]interface{})
+  }
+
+  own := map[string]interface{}{}
+  for k,v := range p {
+    if k != extendsSection {
+      own[k] = v
+    }
+  }
+
+  return mergeRules(merged, own).(map[string]interface{}),nil
+}
+
+// profileExtends returns the names of the profiles a profile extends, in order.
+func profileExtends(profile map[string]interface{}) []string {
+  switch extends := profile[extendsSection].(type) {
+  case string: return []string{extends}
+  case []interface{}:
+    names := make([]string, len(extends))
+    for k,v := range extends {
+      names[k] = v.(string)
+    }
+    return names
+  }
+  return nil
+}
+
+// mergeRules merges src over dst. Objects are merged key by key, "$allow" sections are
+// concatenated and any other rule in src replaces the rule in dst. Command rules and array rules
+// are replaced as a whole, so neither inherits "$output" or selectors from the rule it overrides.
+func mergeRules(dst interface{}, src interface{}) interface{} {
+  d,ok := dst.(map[string]interface{})
+  s,ok2 := src.(map[string]interface{})
+  if !ok || !ok2 || isCommandRule(d) || isCommandRule(s) || isArrayRule(d) || isArrayRule(s) {
+    return src
+  }
+
+  merged := map[string]interface{}{}
+  for k,v := range d {
+    merged[k] = v
+  }
+  for k,v := range s {
+    if existing,ok := merged[k]; !ok {
+      merged[k] = v
+    } else if k == allowSection {
+      merged[k] = append(append([]interface{}{}, existing.([]interface{})...), v.([]interface{})...)
+    } else {
+      merged[k] = mergeRules(existing, v)
+    }
+  }
+  return merged
+}
+
+func validateIncludeSection(section interface{}, path Path, errs *ValidationErrors) {
+  includes,ok := section.([]interface{})
+  if !ok {
+    *errs = append(*errs, &ValidationError{Path: path, Message: fmt.Sprintf("expected an array of filter files, got %s", jsonTypeName(section))})
+    return
+  }
+
+  for k,v := range includes {
+    if file,ok := v.(string); !ok || !isFilterFile(file) {
+      *errs = append(*errs, &ValidationError{Path: path.Append(Index(k)), Message: "expected the path of a .json filter file"})
+    }
+  }
+}
+
+func validateProfilesSection(section interface{}, path Path, errs *ValidationErrors) {
+  profiles,ok := section.(map[string]interface{})
+  if !ok {
+    *errs = append(*errs, &ValidationError{Path: path, Message: fmt.Sprintf("expected an object of profiles, got %s", jsonTypeName(section))})
+    return
+  }
+
+  for _,name := range sortedKeys(profiles) {
+    profilePath := path.Append(Key(name))
+    profile,ok := profiles[name].(map[string]interface{})
+    if !ok {
+      *errs = append(*errs, &ValidationError{Path: profilePath, Message: fmt.Sprintf("expected an object of rules, got %s", jsonTypeName(profiles[name]))})
+      continue
+    }
+
+    for _,k := range sortedKeys(profile) {
+      switch k {
+      case extendsSection: validateExtends(profile[k], profilePath.Append(Key(k)), errs)
+      case allowSection: validateAllowSection(profile[k], profilePath.Append(Key(k)), errs)
+      case includeSection, profilesSection:
+        *errs = append(*errs, &ValidationError{Path: profilePath.Append(Key(k)), Message: "only allowed at the top level of a filter file"})
+      default: validateRule(profile[k], profilePath.Append(Key(k)), errs)
+      }
+    }
+  }
+}
+
+func validateExtends(section interface{}, path Path, errs *ValidationErrors) {
+  switch extends := section.(type) {
+  case string:
+    if len(extends) > 0 {
+      return
+    }
+  case []interface{}:
+    valid := true
+    for _,v := range extends {
+      if name,ok := v.(string); !ok || len(name) == 0 {
+        valid = false
+      }
+    }
+    if valid {
+      return
+    }
+  }
+  *errs = append(*errs, &ValidationError{Path: path, Message: "expected a profile name or an array of profile names"})
+}
+
+// validateProfiles reads a filter file with its includes and checks that every profile extends
+// known profiles without cycles.
+func validateProfiles(filter string) error {
+  filters,err := readFilterFile(filter, map[string]bool{}, nil)
+  if err != nil {
+    return err
+  }
+
+  m,_ := filters.(map[string]interface{})
+  profiles,_ := m[profilesSection].(map[string]interface{})
+  if profiles == nil {
+    return nil
+  }
+
+  messages := []string{}
+  for _,name := range sortedKeys(profiles) {
+    if _,err := resolveProfile(profiles, name, map[string]bool{}); err != nil {
+      messages = append(messages, err.Error())
+    }
+  }
+
+  if len(messages) > 0 {
+    return errors.New(strings.Join(messages, "\n"))
+  }
+  return nil
+}
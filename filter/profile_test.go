@@ -0,0 +1,100 @@
+package filter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const profileJson = `{"id": "1", "ticket": "t", "name": "n", "email": "e", "address": {"city": "c", "street": "s"}}`
+
+func profileOptions(profile string) Options {
+	return Options{
+		FilterRunner: func(command string, value string) (string, error) {
+			return command + "(" + value + ")",nil
+		},
+		DefaultAction: ActionRedact,
+		Profile: profile,
+	}
+}
+
+func TestProfiles_includesAndTopLevelRules(t *testing.T) {
+	expectedJson := `{"address":{"city":"upper(c)","street":"[REDACTED]"},"email":"mask(e)","id":"1","name":"upper(n)","ticket":"[REDACTED]"}`
+
+	if value,err := FilterJsonFromTextWithOptions(profileJson, "./fixtures/profiles-filter.json", profileOptions("")); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if b,_ := json.Marshal(value); string(b) != expectedJson {
+		t.Fatalf("Expected %v got %v", expectedJson, string(b))
+	}
+}
+
+func TestProfiles_extends(t *testing.T) {
+	expectedJson := `{"address":{"city":"upper(c)","street":"upper(s)"},"email":"hash(e)","id":"1","name":"lower(n)","ticket":"t"}`
+
+	if value,err := FilterJsonFromTextWithOptions(profileJson, "./fixtures/profiles-filter.json", profileOptions("partner")); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if b,_ := json.Marshal(value); string(b) != expectedJson {
+		t.Fatalf("Expected %v got %v", expectedJson, string(b))
+	}
+}
+
+func TestProfiles_arrayRulesAreReplaced(t *testing.T) {
+	data := `{"tags": ["a", "b", "c"], "owner": {"name": "n"}}`
+	expected := map[string]string{
+		"partner": `{"owner":{"name":"upper(n)"},"tags":["[REDACTED]","[REDACTED]","hash(c)"]}`,
+		"support": `{"owner":{"name":"[REDACTED]"},"tags":["[REDACTED]","[REDACTED]","[REDACTED]"]}`,
+	}
+
+	for profile,expectedJson := range expected {
+		if value,err := FilterJsonFromTextWithOptions(data, "./fixtures/profiles-array-filter.json", profileOptions(profile)); err != nil {
+			t.Fatalf("Expected no error for profile %s :: %v", profile, err.Error())
+		} else if b,_ := json.Marshal(value); string(b) != expectedJson {
+			t.Fatalf("Expected %v for profile %s got %v", expectedJson, profile, string(b))
+		}
+	}
+}
+
+func TestProfiles_commandRulesAreReplaced(t *testing.T) {
+	data := `{"name": "n", "address": {"city": "c", "street": "s"}, "owner": {"name": "o"}}`
+	expected := map[string]string{
+		"partner": `{"address":{"city":"hash(c)","street":"hash(s)"},"name":"lower(n)","owner":{"name":"lower(o)"}}`,
+		"support": `{"address":{"city":"upper(c)","street":"upper(s)"},"name":"lower(n)","owner":{"name":"lower(o)"}}`,
+	}
+
+	for profile,expectedJson := range expected {
+		if value,err := FilterJsonFromTextWithOptions(data, "./fixtures/profiles-command-filter.json", profileOptions(profile)); err != nil {
+			t.Fatalf("Expected no error for profile %s :: %v", profile, err.Error())
+		} else if b,_ := json.Marshal(value); string(b) != expectedJson {
+			t.Fatalf("Expected %v for profile %s got %v", expectedJson, profile, string(b))
+		}
+	}
+}
+
+func TestProfiles_errors(t *testing.T) {
+	if _,err := Compile("./fixtures/profiles-filter.json", Options{Profile: "unknown"}); err == nil || !strings.Contains(err.Error(), "Unknown profile 'unknown'") {
+		t.Fatalf("Expected an unknown profile error got %v", err)
+	}
+	if _,err := Compile("upper", Options{Profile: "partner"}); err == nil {
+		t.Fatalf("Expected an error selecting a profile of a command")
+	}
+	if err := Validate("./fixtures/include-cycle-filter.json"); err == nil || !strings.Contains(err.Error(), "includes itself") {
+		t.Fatalf("Expected an include cycle error got %v", err)
+	}
+
+	profiles := map[string]interface{}{
+		"a": map[string]interface{}{"$extends": "b"},
+		"b": map[string]interface{}{"$extends": []interface{}{"a"}},
+	}
+	if _,err := resolveProfile(profiles, "a", map[string]bool{}); err == nil || !strings.Contains(err.Error(), "extends itself") {
+		t.Fatalf("Expected a profile cycle error got %v", err)
+	}
+}
+
+func TestProfiles_listsProfilesAndIncludes(t *testing.T) {
+	if names,err := Profiles("./fixtures/profiles-filter.json"); err != nil || strings.Join(names, ",") != "partner,support" {
+		t.Fatalf("Unexpected profiles %v :: %v", names, err)
+	}
+	if files,err := Includes("./fixtures/profiles-filter.json"); err != nil || len(files) != 2 || !strings.HasSuffix(files[1], "profiles-base.json") {
+		t.Fatalf("Unexpected includes %v :: %v", files, err)
+	}
+}
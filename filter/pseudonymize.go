@@ -0,0 +1,257 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "crypto/hmac"
+  "crypto/sha256"
+  "encoding/binary"
+  "encoding/hex"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "regexp"
+  "strings"
+  "sync"
+  "unicode"
+)
+
+// Pseudonymize formats. FormatAuto picks FormatEmail or FormatUUID when the value looks like
+// one and FormatChars otherwise.
+const (
+  FormatAuto = "auto"
+  FormatEmail = "email"
+  FormatUUID = "uuid"
+  FormatDigits = "digits"
+  FormatChars = "chars"
+  FormatToken = "token"
+)
+
+var (
+  emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+  uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// errMissingSecret is returned by keyed built-in filters when Options.Secret is empty.
+var errMissingSecret = errors.New("A secret is required, set Options.Secret")
+
+// Pseudonymize deterministically maps value to a fake value of the same format using an HMAC keyed
+// by secret. The same value, format and secret always produce the same pseudonym, so references
+// between documents are preserved. Supported formats are:
+//
+//   auto   - email or uuid when the value looks like one, otherwise chars
+//   email  - a valid email address in the reserved ".example" top-level domain
+//   uuid   - a version 4 UUID with the same letter case
+//   digits - every digit replaced by a digit, everything else kept
+//   chars  - every letter replaced by a letter of the same case and every digit by a digit
+//   token  - a 16 character hex token
+func Pseudonymize(value string, format string, secret []byte) (string, error) {
+  if len(secret) == 0 {
+    return "",errMissingSecret
+  }
+
+  if format == FormatAuto || format == "" {
+    if emailPattern.MatchString(value) {
+      format = FormatEmail
+    } else if uuidPattern.MatchString(value) {
+      format = FormatUUID
+    } else {
+      format = FormatChars
+    }
+  }
+
+  stream := newKeyStream(secret, format + ":" + value)
+
+  switch format {
+  case FormatEmail:
+    return stream.hex(10) + "@" + stream.hex(8) + ".example",nil
+  case FormatUUID:
+    uuid := stream.uuid()
+    if strings.ToUpper(value) == value {
+      uuid = strings.ToUpper(uuid)
+    }
+    return uuid,nil
+  case FormatDigits:
+    return mapRunes(value, func (r rune) rune {
+      if r >= '0' && r <= '9' {
+        return rune('0' + stream.intn(10))
+      }
+      return r
+    }),nil
+  case FormatChars:
+    return mapRunes(value, func (r rune) rune {
+      switch {
+      case r >= '0' && r <= '9': return rune('0' + stream.intn(10))
+      case unicode.IsUpper(r): return rune('A' + stream.intn(26))
+      case unicode.IsLower(r): return rune('a' + stream.intn(26))
+      }
+      return r
+    }),nil
+  case FormatToken:
+    return stream.hex(16),nil
+  }
+
+  return "",fmt.Errorf("Unknown pseudonymize format '%s'", format)
+}
+
+// pseudonymizeBuiltin implements "builtin:pseudonymize[:<format>]".
+func pseudonymizeBuiltin(args string, value string, options Options) (result string, err error) {
+  if result,err = Pseudonymize(value, args, options.Secret); err == nil && options.Mapping != nil {
+    err = options.Mapping.add(result, value)
+  }
+  return
+}
+
+// originalBuiltin undoes "builtin:pseudonymize" by looking up the original value in Options.Mapping.
+func originalBuiltin(args string, value string, options Options) (string, error) {
+  if options.Mapping == nil {
+    return "",errors.New("A mapping is required to reverse pseudonymization, set Options.Mapping")
+  } else if original,ok := options.Mapping.Original(value); ok {
+    return original,nil
+  }
+  return "",fmt.Errorf("No original value found for pseudonym '%s'", value)
+}
+
+func pseudonymizeBuiltinArgs(args string) error {
+  switch args {
+  case "", FormatAuto, FormatEmail, FormatUUID, FormatDigits, FormatChars, FormatToken: return nil
+  }
+  return fmt.Errorf("unknown pseudonymize format '%s'", args)
+}
+
+func mapRunes(value string, mapping func (r rune) rune) string {
+  var buf strings.Builder
+  for _,r := range value {
+    buf.WriteRune(mapping(r))
+  }
+  return buf.String()
+}
+
+// keyStream is a deterministic stream of bytes derived from a secret and a message by
+// running HMAC-SHA256 in counter mode.
+type keyStream struct {
+  secret []byte
+  message string
+  counter uint32
+  buf []byte
+}
+
+func newKeyStream(secret []byte, message string) *keyStream {
+  return &keyStream{secret: secret, message: message}
+}
+
+func (s *keyStream) bytes(n int) []byte {
+  for len(s.buf) < n {
+    mac := hmac.New(sha256.New, s.secret)
+    binary.Write(mac, binary.BigEndian, s.counter)
+    io.WriteString(mac, s.message)
+    s.buf = mac.Sum(s.buf)
+    s.counter++
+  }
+
+  b := make([]byte, n)
+  copy(b, s.buf)
+  s.buf = s.buf[n:]
+  return b
+}
+
+func (s *keyStream) hex(n int) string {
+  return hex.EncodeToString(s.bytes((n + 1) / 2))[:n]
+}
+
+func (s *keyStream) uint64() uint64 {
+  return binary.BigEndian.Uint64(s.bytes(8))
+}
+
+// uuid returns a version 4 UUID in lowercase.
+func (s *keyStream) uuid() string {
+  b := s.bytes(16)
+  b[6] = (b[6] & 0x0f) | 0x40
+  b[8] = (b[8] & 0x3f) | 0x80
+  h := hex.EncodeToString(b)
+  return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// intn returns a uniformly distributed integer in [0, n) for n <= 256.
+func (s *keyStream) intn(n int) int {
+  limit := 256 - 256 % n
+  for {
+    if b := int(s.bytes(1)[0]); b < limit {
+      return b % n
+    }
+  }
+}
+
+// Mapping records the original value of every pseudonym produced while filtering so that
+// authorized users can reverse pseudonymization. Set Options.Mapping to collect a mapping.
+// The digits and chars formats map short values onto few pseudonyms, so two values can share
+// a pseudonym; filtering fails rather than record a mapping that cannot be reversed.
+// A Mapping is safe for concurrent use.
+type Mapping struct {
+  mutex sync.Mutex
+  originals map[string]string
+}
+
+// NewMapping returns an empty mapping table.
+func NewMapping() *Mapping {
+  return &Mapping{originals: map[string]string{}}
+}
+
+// ReadMapping reads a mapping table previously written by Mapping.WriteTo.
+func ReadMapping(reader io.Reader) (*Mapping, error) {
+  m := NewMapping()
+  if err := json.NewDecoder(reader).Decode(&m.originals); err != nil {
+    return nil,err
+  } else if m.originals == nil {
+    // A null mapping table is an empty one.
+    m.originals = map[string]string{}
+  }
+  return m,nil
+}
+
+// Original returns the original value of a pseudonym.
+func (m *Mapping) Original(pseudonym string) (original string, ok bool) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  original,ok = m.originals[pseudonym]
+  return
+}
+
+// Len returns the number of pseudonyms in the mapping.
+func (m *Mapping) Len() int {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  return len(m.originals)
+}
+
+// MarshalJSON encodes the mapping as an object of pseudonyms to original values.
+func (m *Mapping) MarshalJSON() ([]byte, error) {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  return json.Marshal(m.originals)
+}
+
+// WriteTo writes the mapping to writer as JSON.
+func (m *Mapping) WriteTo(writer io.Writer) (int64, error) {
+  b,err := m.MarshalJSON()
+  if err != nil {
+    return 0,err
+  }
+  n,err := writer.Write(b)
+  return int64(n),err
+}
+
+// add records the original value of a pseudonym. Fails when the pseudonym is already the
+// pseudonym of a different value.
+func (m *Mapping) add(pseudonym string, original string) error {
+  m.mutex.Lock()
+  defer m.mutex.Unlock()
+  if existing,ok := m.originals[pseudonym]; ok && existing != original {
+    return fmt.Errorf("Pseudonym '%s' is already mapped to a different value and could not be reversed", pseudonym)
+  }
+  m.originals[pseudonym] = original
+  return nil
+}
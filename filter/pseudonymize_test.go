@@ -0,0 +1,105 @@
+package filter
+
+import (
+	"testing"
+	"bytes"
+	"regexp"
+	"strings"
+	"encoding/json"
+)
+
+func TestPseudonymize_formats(t *testing.T) {
+	secret := []byte("s3cret")
+	cases := []struct {
+		value string
+		format string
+		pattern string
+	}{
+		{"darren@example.com", FormatAuto, `^[0-9a-f]{10}@[0-9a-f]{8}\.example$`},
+		{"3F2504E0-4F89-11D3-9A0C-0305E82C3301", FormatAuto, `^[0-9A-F]{8}-[0-9A-F]{4}-4[0-9A-F]{3}-[89AB][0-9A-F]{3}-[0-9A-F]{12}$`},
+		{"+1 (604) 555-0199", FormatDigits, `^\+\d \(\d{3}\) \d{3}-\d{4}$`},
+		{"Max Power 42", FormatAuto, `^[A-Z][a-z]{2} [A-Z][a-z]{4} \d\d$`},
+		{"anything", FormatToken, `^[0-9a-f]{16}$`},
+	}
+
+	for _,c := range cases {
+		first,err := Pseudonymize(c.value, c.format, secret)
+		if err != nil {
+			t.Fatalf("Expected no error :: %v", err.Error())
+		}
+		if !regexp.MustCompile(c.pattern).MatchString(first) {
+			t.Fatalf("Expected pseudonym of '%v' to match '%v' got '%v'", c.value, c.pattern, first)
+		}
+		if first == c.value {
+			t.Fatalf("Expected pseudonym of '%v' to differ from the value", c.value)
+		}
+		if second,_ := Pseudonymize(c.value, c.format, secret); second != first {
+			t.Fatalf("Expected pseudonyms to be deterministic got '%v' and '%v'", first, second)
+		}
+		if other,_ := Pseudonymize(c.value, c.format, []byte("other")); other == first {
+			t.Fatalf("Expected pseudonyms to depend on the secret")
+		}
+	}
+
+	if _,err := Pseudonymize("x", FormatAuto, nil); err == nil {
+		t.Fatalf("Expected an error without a secret")
+	}
+}
+
+func TestPseudonymizeBuiltin_consistentMapping(t *testing.T) {
+	mapping := NewMapping()
+	options := Options{Secret: []byte("s3cret"), Mapping: mapping}
+	jsonText := `{"a": {"email": "x@y.io"}, "b": [{"email": "x@y.io"}, {"email": "z@y.io"}]}`
+
+	value,err := FilterJsonFromTextWithOptions(jsonText, "builtin:pseudonymize:email", options)
+	if err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+
+	m := value.(map[string]interface{})
+	first := m["a"].(map[string]interface{})["email"].(string)
+	items := m["b"].([]interface{})
+	if items[0].(map[string]interface{})["email"] != first || items[1].(map[string]interface{})["email"] == first {
+		t.Fatalf("Expected equal values to share a pseudonym :: %v", value)
+	}
+
+	if original,ok := mapping.Original(first); !ok || original != "x@y.io" || mapping.Len() != 2 {
+		t.Fatalf("Expected the mapping to record the original value")
+	}
+
+	var buf bytes.Buffer
+	mapping.WriteTo(&buf)
+	if read,err := ReadMapping(&buf); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if original,_ := read.Original(first); original != "x@y.io" {
+		t.Fatalf("Expected the mapping to round trip")
+	}
+
+	if b,_ := json.Marshal(mapping); !bytes.Contains(b, []byte(`"x@y.io"`)) {
+		t.Fatalf("Expected the mapping to marshal :: %v", string(b))
+	}
+}
+
+func TestPseudonymizeBuiltin_collidingMapping(t *testing.T) {
+	options := Options{Secret: []byte("k"), Mapping: NewMapping()}
+
+	// With this secret the digits 5, 6 and 9 share the pseudonym "8".
+	_,err := FilterJsonFromTextWithOptions(`["5", "6"]`, "builtin:pseudonymize:digits", options)
+	if err == nil || !strings.Contains(err.Error(), "already mapped to a different value") {
+		t.Fatalf("Expected a colliding pseudonym to fail :: %v", err)
+	}
+
+	options.Mapping = NewMapping()
+	if _,err = FilterJsonFromTextWithOptions(`["5", "5"]`, "builtin:pseudonymize:digits", options); err != nil {
+		t.Fatalf("Expected equal values to share a pseudonym :: %v", err.Error())
+	}
+}
+
+func TestReadMapping_null(t *testing.T) {
+	mapping,err := ReadMapping(strings.NewReader("null"))
+	if err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if err = mapping.add("p", "o"); err != nil || mapping.Len() != 1 {
+		t.Fatalf("Expected a null mapping to be empty :: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "fmt"
+  "io"
+  "sort"
+  "strings"
+  "text/tabwriter"
+  "encoding/json"
+)
+
+// ReportEntry counts the string values found at a path pattern. Path is a JSONPath expression
+// with array indices collapsed to "[*]" (see Path.Pattern). Allowed counts values without a rule
+// that are listed in the "$allow" section of the filter file. Commands counts how many values were
+// filtered by each command.
+type ReportEntry struct {
+  Path string `json:"path"`
+  Filtered int `json:"filtered"`
+  Allowed int `json:"allowed"`
+  Unmatched int `json:"unmatched"`
+  Commands map[string]int `json:"commands"`
+}
+
+// Report is a coverage report listing, for each path pattern, how many string values were
+// filtered and by which command, how many were explicitly allowed and how many had no matching
+// rule. Set Options.Report to collect a report while filtering. A Report can collect the coverage
+// of several documents but must not be shared by concurrent filters.
+type Report struct {
+  entries map[string]*ReportEntry
+}
+
+// NewReport returns an empty coverage report.
+func NewReport() *Report {
+  return &Report{entries: map[string]*ReportEntry{}}
+}
+
+// Entries returns every entry in the report sorted by path.
+func (r *Report) Entries() []ReportEntry {
+  entries := make([]ReportEntry, 0, len(r.entries))
+  for _,entry := range r.entries {
+    entries = append(entries, *entry)
+  }
+  sort.Sort(entriesByPath(entries))
+  return entries
+}
+
+// Unmatched returns the path patterns of every string value that had no matching rule and was
+// not allowed, sorted.
+func (r *Report) Unmatched() []string {
+  paths := []string{}
+  for path,entry := range r.entries {
+    if entry.Unmatched > 0 {
+      paths = append(paths, path)
+    }
+  }
+  sort.Strings(paths)
+  return paths
+}
+
+// MarshalJSON encodes the report as an object with "entries" and "unmatched" members.
+func (r *Report) MarshalJSON() ([]byte, error) {
+  return json.Marshal(struct {
+    Entries []ReportEntry `json:"entries"`
+    Unmatched []string `json:"unmatched"`
+  }{r.Entries(), r.Unmatched()})
+}
+
+// WriteTable writes the report to writer as an aligned plain text table.
+func (r *Report) WriteTable(writer io.Writer) error {
+  w := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+  fmt.Fprintln(w, "PATH\tFILTERED\tALLOWED\tUNMATCHED\tCOMMANDS")
+
+  for _,entry := range r.Entries() {
+    commands := make([]string, 0, len(entry.Commands))
+    for command,count := range entry.Commands {
+      commands = append(commands, fmt.Sprintf("%s=%d", command, count))
+    }
+    sort.Strings(commands)
+    fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", entry.Path, entry.Filtered, entry.Allowed, entry.Unmatched, strings.Join(commands, ", "))
+  }
+
+  return w.Flush()
+}
+
+func (r *Report) record(path Path, command string, matched bool, allowed bool) {
+  pattern := path.Pattern()
+  entry,ok := r.entries[pattern]
+  if !ok {
+    entry = &ReportEntry{Path: pattern, Commands: map[string]int{}}
+    r.entries[pattern] = entry
+  }
+
+  if matched {
+    entry.Filtered++
+    entry.Commands[command]++
+  } else if allowed {
+    entry.Allowed++
+  } else {
+    entry.Unmatched++
+  }
+}
+
+type entriesByPath []ReportEntry
+
+func (e entriesByPath) Len() int { return len(e) }
+func (e entriesByPath) Less(i, j int) bool { return e[i].Path < e[j].Path }
+func (e entriesByPath) Swap(i, j int) { e[i],e[j] = e[j],e[i] }
@@ -0,0 +1,39 @@
+package filter
+
+import (
+	"testing"
+	"bytes"
+	"encoding/json"
+)
+
+func TestReport_coverage(t *testing.T) {
+	expectedJson := `{"entries":[{"path":"$.a[*].age","filtered":0,"allowed":0,"unmatched":2,"commands":{}},{"path":"$.a[*].name","filtered":3,"allowed":0,"unmatched":0,"commands":{"lower":3}},{"path":"$.b","filtered":0,"allowed":0,"unmatched":1,"commands":{}}],"unmatched":["$.a[*].age","$.b"]}`
+	expectedTable := "PATH         FILTERED  ALLOWED  UNMATCHED  COMMANDS\n" +
+		"$.a[*].age   0         0        2          \n" +
+		"$.a[*].name  3         0        0          lower=3\n" +
+		"$.b          0         0        1          \n"
+
+	filterRunner := func(command string, value string) (string, error) {
+		return value,nil
+	}
+	report := NewReport()
+	options := Options{FilterRunner: filterRunner, Report: report}
+	jsonText := `{"a": [{"name": "x", "age": "1"}, {"name": "y"}, {"name": "z", "age": "2"}], "b": "w", "c": 1}`
+
+	if _,err := FilterJsonFromTextWithOptions(jsonText, "./fixtures/array-filter-homogenous-object.json", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+
+	if b,err := json.Marshal(report); err != nil {
+		t.Fatalf("Expected report to marshal :: %v", err.Error())
+	} else if string(b) != expectedJson {
+		t.Fatalf("Expected report to be '%v' got '%v'", expectedJson, string(b))
+	}
+
+	var table bytes.Buffer
+	if err := report.WriteTable(&table); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if table.String() != expectedTable {
+		t.Fatalf("Expected table to be\n%v\ngot\n%v", expectedTable, table.String())
+	}
+}
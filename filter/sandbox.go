@@ -0,0 +1,124 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "fmt"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strings"
+  "time"
+)
+
+// Sandbox restricts filter commands run on the command line, for filter files that come from
+// people who should not be trusted with the environment, working directory and privileges of the
+// caller. Commands run with an empty environment unless variables are listed in Env. Resource
+// limits are only supported on Linux, where a copy of the current executable is started in place of
+// each command to apply them before the command is executed, so the program must call SandboxMain.
+// They apply to each process the command starts separately. The file system and the network are
+// not isolated.
+type Sandbox struct {
+  // Env lists the environment variables passed to filter commands, either as NAME to pass the
+  // variable of the current environment or as NAME=value.
+  Env []string
+  // Dir is the working directory of filter commands. Defaults to os.TempDir().
+  Dir string
+  // Executables lists the commands allowed to run, either by name, which allows the executable
+  // found in the PATH, or by absolute path. Any command may run when Executables is empty.
+  Executables []string
+  // CPUTime limits the CPU time of each filter command, rounded up to whole seconds. The command
+  // is killed when it runs out. 0 means no limit.
+  CPUTime time.Duration
+  // Memory limits the address space of each filter command, in bytes. 0 means no limit.
+  Memory uint64
+  // FileSize limits the size of any file a filter command writes, in bytes, and how much of its
+  // output is read, failing with a LimitError beyond that. 0 means no limit.
+  FileSize uint64
+}
+
+// sandboxMain records that SandboxMain was called, so the current executable can start filter
+// commands with resource limits.
+var sandboxMain bool
+
+// SandboxMain must be called first thing in main by programs that run filter commands with the
+// resource limits of a Sandbox. When the sandbox started the program in place of a filter command,
+// it applies the limits and executes the command, never returning. Otherwise it returns right away.
+func SandboxMain() {
+  sandboxMain = true
+  sandboxExec()
+}
+
+// hasLimits determines if the sandbox sets any resource limit.
+func (s *Sandbox) hasLimits() bool {
+  return s.CPUTime > 0 || s.Memory > 0 || s.FileSize > 0
+}
+
+// outputLimit returns the most output read from a filter command given the max of the filter
+// output limit, 0 meaning no limit. The output of a command is a pipe rather than a file, which
+// the FileSize resource limit does not apply to, so it is lowered to FileSize too.
+func (s *Sandbox) outputLimit(max int64) int64 {
+  if s.FileSize > 0 && (max == 0 || int64(s.FileSize) < max) {
+    return int64(s.FileSize)
+  }
+  return max
+}
+
+// environ returns the environment of filter commands.
+func (s *Sandbox) environ() []string {
+  env := []string{}
+  for _,v := range s.Env {
+    if strings.Contains(v, "=") {
+      env = append(env, v)
+    } else if value,ok := os.LookupEnv(v); ok {
+      env = append(env, v + "=" + value)
+    }
+  }
+  return env
+}
+
+// allowed determines if the executable name resolved to path may run.
+func (s *Sandbox) allowed(name string, path string) bool {
+  if len(s.Executables) == 0 {
+    return true
+  }
+
+  for _,executable := range s.Executables {
+    if filepath.IsAbs(executable) {
+      if filepath.Clean(executable) == path {
+        return true
+      }
+    } else if executable == name && !strings.ContainsRune(name, filepath.Separator) {
+      return true
+    }
+  }
+  return false
+}
+
+// prepare restricts a command before it is started.
+func (s *Sandbox) prepare(cmd *exec.Cmd, name string) error {
+  path := cmd.Path
+  if abs,err := filepath.Abs(path); err == nil {
+    path = abs
+  }
+  if !s.allowed(name, path) {
+    return fmt.Errorf("Executable '%s' is not allowed by the sandbox", name)
+  } else if s.hasLimits() && !resourceLimitsSupported {
+    return fmt.Errorf("Resource limits are not supported on this platform")
+  } else if s.hasLimits() && !sandboxMain {
+    return fmt.Errorf("Resource limits require the program to call SandboxMain first thing in main")
+  }
+
+  // A relative path would be resolved against the working directory of the sandbox.
+  cmd.Path = path
+  cmd.Env = s.environ()
+  if cmd.Dir = s.Dir; len(cmd.Dir) == 0 {
+    cmd.Dir = os.TempDir()
+  }
+  if s.hasLimits() {
+    return s.limit(cmd)
+  }
+  return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "fmt"
+  "os"
+  "os/exec"
+  "strconv"
+  "strings"
+  "syscall"
+  "unsafe"
+)
+
+const resourceLimitsSupported = true
+
+// A process started with sandboxExecEnv set to the path of a command applies the resource limits
+// in sandboxLimitsEnv to itself and then replaces itself with the command. See limit.
+const (
+  sandboxExecEnv = "JSONFILTER_SANDBOX_EXEC"
+  sandboxLimitsEnv = "JSONFILTER_SANDBOX_LIMITS"
+)
+
+// sandboxExec executes the command the sandbox started the current process for, if any. See
+// SandboxMain.
+func sandboxExec() {
+  if path,ok := os.LookupEnv(sandboxExecEnv); ok {
+    execLimited(path)
+  }
+}
+
+// limit makes a command apply the resource limits of the sandbox before it is executed. A copy of
+// the current executable, which called SandboxMain, is started in its place, applies the limits to
+// itself and then executes the command, which keeps the limits. Any process the command starts
+// inherits them too.
+func (s *Sandbox) limit(cmd *exec.Cmd) error {
+  self,err := os.Executable()
+  if err != nil {
+    return fmt.Errorf("Failed to limit resources :: %v", err)
+  }
+
+  cpu := (uint64(s.CPUTime) + 999999999) / 1000000000
+  cmd.Env = append(cmd.Env, sandboxExecEnv + "=" + cmd.Path, fmt.Sprintf("%s=%d,%d,%d", sandboxLimitsEnv, cpu, s.Memory, s.FileSize))
+  cmd.Args = append([]string{self}, cmd.Args...)
+  cmd.Path = self
+  return nil
+}
+
+// execLimited applies the resource limits to the current process and executes the command at
+// path with the remaining arguments and environment. Everything is allocated before the limits
+// are applied, so a low memory limit cannot fail the process before the command runs. Never
+// returns, the process exits with status 126 if the command cannot be executed.
+func execLimited(path string) {
+  var values []uint64
+  env := []string{}
+  for _,v := range os.Environ() {
+    if strings.HasPrefix(v, sandboxLimitsEnv + "=") {
+      for _,n := range strings.Split(v[len(sandboxLimitsEnv) + 1:], ",") {
+        value,_ := strconv.ParseUint(n, 10, 64)
+        values = append(values, value)
+      }
+    } else if !strings.HasPrefix(v, sandboxExecEnv + "=") {
+      env = append(env, v)
+    }
+  }
+
+  argv0,err := syscall.BytePtrFromString(path)
+  var argv, envv []*byte
+  if err == nil {
+    argv,err = syscall.SlicePtrFromStrings(os.Args[1:])
+  }
+  if err == nil {
+    envv,err = syscall.SlicePtrFromStrings(env)
+  }
+  if err == nil && len(values) != 3 {
+    err = fmt.Errorf("expected three limits in %s", sandboxLimitsEnv)
+  }
+
+  if err == nil {
+    err = setLimits(values[0], values[1], values[2])
+  }
+  if err == nil {
+    _,_,errno := syscall.RawSyscall(syscall.SYS_EXECVE, uintptr(unsafe.Pointer(argv0)), uintptr(unsafe.Pointer(&argv[0])), uintptr(unsafe.Pointer(&envv[0])))
+    err = errno
+  }
+
+  fmt.Fprintf(os.Stderr, "Failed to execute '%s' with resource limits :: %v\n", path, err)
+  os.Exit(126)
+}
+
+// setLimits applies resource limits to the current process with prlimit(2), without allocating.
+// A limit of 0 is not applied.
+func setLimits(cpu uint64, memory uint64, fileSize uint64) error {
+  limits := [...]struct {
+    resource int
+    value uint64
+  }{
+    {syscall.RLIMIT_CPU, cpu},
+    {syscall.RLIMIT_AS, memory},
+    {syscall.RLIMIT_FSIZE, fileSize},
+  }
+
+  for _,limit := range limits {
+    if limit.value == 0 {
+      continue
+    }
+    rlimit := syscall.Rlimit{Cur: limit.value, Max: limit.value}
+    _,_,errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, 0, uintptr(limit.resource), uintptr(unsafe.Pointer(&rlimit)), 0, 0, 0)
+    if errno != 0 {
+      return errno
+    }
+  }
+  return nil
+}
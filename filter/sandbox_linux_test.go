@@ -0,0 +1,74 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSandbox_limits(t *testing.T) {
+	options := Options{Sandbox: &Sandbox{CPUTime: 1500 * time.Millisecond, Memory: 512 << 20, FileSize: 1 << 20}}
+
+	// The limits are read by the command itself, so they were in place before it was executed.
+	limits,err := commandLineFilterRunner("cat /proc/self/limits", "", options)
+	if err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+
+	for _,expected := range []string{`Max cpu time\s+2\s+2`, `Max address space\s+536870912\s+536870912`, `Max file size\s+1048576\s+1048576`} {
+		if !regexp.MustCompile(expected).MatchString(limits) {
+			t.Fatalf("Expected a limit matching %v got\n%s", expected, limits)
+		}
+	}
+}
+
+func TestSandbox_limitsEnvironment(t *testing.T) {
+	options := Options{Sandbox: &Sandbox{Env: []string{"FOO=bar"}, Memory: 512 << 20}}
+
+	if result,err := commandLineFilterRunner("env", "", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if result != "FOO=bar" {
+		t.Fatalf("Expected only the listed variables got %q", result)
+	}
+}
+
+func TestSandbox_memoryLimit(t *testing.T) {
+	// Cat needs more than 1MB of address space to load, which fails only if the limit is already in place.
+	options := Options{Sandbox: &Sandbox{Memory: 1 << 20}}
+
+	if _,err := commandLineFilterRunner("cat", "abc", options); err == nil {
+		t.Fatalf("Expected the memory limit to stop the command")
+	}
+}
+
+func TestSandbox_limitsWithoutSandboxMain(t *testing.T) {
+	sandboxMain = false
+	defer func() { sandboxMain = true }()
+	options := Options{Sandbox: &Sandbox{Memory: 512 << 20}}
+
+	if _,err := commandLineFilterRunner("cat", "abc", options); err == nil || !strings.Contains(err.Error(), "SandboxMain") {
+		t.Fatalf("Expected an error asking for SandboxMain got %v", err)
+	}
+}
+
+func TestSandbox_fileSizeLimitsOutput(t *testing.T) {
+	// The output of a command is a pipe, which the file size limit of the process does not apply to.
+	options := Options{Sandbox: &Sandbox{FileSize: 1024}}
+
+	_,err := commandLineFilterRunner("yes", "", options)
+	expectLimitError(t, err, LimitFilterOutput, "")
+	if e := err.(*LimitError); e.Max != 1024 {
+		t.Fatalf("Expected the file size to bound the output got %v", e)
+	}
+
+	options.Limits = Limits{FilterOutput: 100}
+	_,err = commandLineFilterRunner("yes", "", options)
+	expectLimitError(t, err, LimitFilterOutput, "")
+	if e := err.(*LimitError); e.Max != 100 {
+		t.Fatalf("Expected the smaller filter output limit to apply got %v", e)
+	}
+	if result,err := commandLineFilterRunner("head -c 100", strings.Repeat("a", 200), options); err != nil || len(result) != 100 {
+		t.Fatalf("Expected output within both limits to be read got %q :: %v", result, err)
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package filter
+
+import (
+  "errors"
+  "os/exec"
+)
+
+const resourceLimitsSupported = false
+
+func sandboxExec() {}
+
+func (s *Sandbox) limit(cmd *exec.Cmd) error {
+  return errors.New("Resource limits are not supported on this platform")
+}
@@ -0,0 +1,53 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain lets the test binary start filter commands with resource limits, as the jsonfilter
+// command does.
+func TestMain(m *testing.M) {
+	SandboxMain()
+	os.Exit(m.Run())
+}
+
+func TestSandbox_environment(t *testing.T) {
+	os.Setenv("JSONFILTER_SANDBOX_TEST", "passed")
+	defer os.Unsetenv("JSONFILTER_SANDBOX_TEST")
+	options := Options{Sandbox: &Sandbox{Env: []string{"FOO=bar", "JSONFILTER_SANDBOX_TEST", "JSONFILTER_MISSING"}}}
+
+	if result,err := commandLineFilterRunner("env", "", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if result != "FOO=bar\nJSONFILTER_SANDBOX_TEST=passed" {
+		t.Fatalf("Expected only the listed variables got %q", result)
+	}
+}
+
+func TestSandbox_dir(t *testing.T) {
+	dir,_ := filepath.EvalSymlinks(t.TempDir())
+	options := Options{Sandbox: &Sandbox{Dir: dir}}
+
+	if result,err := commandLineFilterRunner("pwd", "", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if result != dir {
+		t.Fatalf("Expected %v got %v", dir, result)
+	}
+}
+
+func TestSandbox_executables(t *testing.T) {
+	options := Options{Sandbox: &Sandbox{Executables: []string{"cat"}}}
+
+	if result,err := commandLineFilterRunner("cat", "abc", options); err != nil || result != "abc" {
+		t.Fatalf("Expected cat to be allowed got %q :: %v", result, err)
+	}
+	if _,err := commandLineFilterRunner("rev", "abc", options); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("Expected rev to be rejected got %v", err)
+	}
+
+	if _,err := FilterJsonFromTextWithOptions(`{"a": "abc"}`, "rev", options); err == nil {
+		t.Fatalf("Expected filtering with rev to fail")
+	}
+}
@@ -0,0 +1,688 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "fmt"
+  "math"
+  "net/url"
+  "reflect"
+  "regexp"
+  "strings"
+  "sync"
+  "unicode/utf8"
+)
+
+const (
+  // schemaKeyword marks a filter file as a JSON Schema.
+  schemaKeyword = "$schema"
+  // filterKeyword is the schema keyword holding the command for the values a schema describes.
+  filterKeyword = "x-filter"
+  // formatsKeyword is a top-level schema keyword mapping formats to commands. It extends and
+  // overrides defaultSchemaFormats.
+  formatsKeyword = "x-filter-formats"
+  // maxSchemaDepth limits how many schemas can be applied to a single value, so that a $ref
+  // cycle that never descends into the data cannot recurse forever.
+  maxSchemaDepth = 64
+)
+
+// defaultSchemaFormats are the commands used for string values whose schema has a format and
+// no "x-filter" keyword.
+var defaultSchemaFormats = map[string]string{
+  "email": "builtin:fake:email",
+  "idn-email": "builtin:fake:email",
+  "uuid": "builtin:fake:uuid",
+  "date": "builtin:fake:date",
+  "date-time": "builtin:fake:date",
+  "ipv4": "builtin:detect:ipv4",
+  "ipv6": "builtin:detect:ipv6",
+}
+
+// unsupportedSchemaKeywords are the keywords LoadSchema and schema filter files reject rather
+// than silently ignore, since a schema relying on them would validate or filter less than
+// expected.
+var unsupportedSchemaKeywords = map[string]bool{
+  "unevaluatedProperties": true,
+  "unevaluatedItems": true,
+  "dependentRequired": true,
+  "dependentSchemas": true,
+  "dependencies": true,
+  "propertyNames": true,
+  "minContains": true,
+  "maxContains": true,
+  "$anchor": true,
+  "$dynamicRef": true,
+  "$dynamicAnchor": true,
+  "$recursiveRef": true,
+  "$recursiveAnchor": true,
+}
+
+// schemaSpec is a filter written as a JSON Schema. Since "oneOf" and "anyOf" branches are selected
+// by validating them against the data, the commands depend on the document and are resolved for
+// every document filtered (see commands).
+type schemaSpec struct {
+  root map[string]interface{}
+  formats map[string]string
+  mutex sync.Mutex
+  patterns map[string]*regexp.Regexp
+}
+
+// Schema is a JSON Schema that documents can be validated against, i.e. to check that filtering
+// produced what downstream consumers expect. See LoadSchema.
+type Schema struct {
+  spec *schemaSpec
+}
+
+// SchemaError describes a value that does not satisfy a schema.
+// Path is the location of the value within the JSON data.
+type SchemaError struct {
+  Path Path
+  Message string
+}
+
+func (e *SchemaError) Error() string {
+  return fmt.Sprintf("Invalid value at %s :: %s", e.Path, e.Message)
+}
+
+// SchemaErrors is returned when a document does not satisfy a schema.
+type SchemaErrors []*SchemaError
+
+func (e SchemaErrors) Error() string {
+  messages := make([]string, len(e))
+  for k,v := range e {
+    messages[k] = v.Error()
+  }
+  return strings.Join(messages, "\n")
+}
+
+// LoadSchema reads a JSON Schema from a file. A subset of draft 2020-12 is supported: "$ref"
+// within the schema, "allOf", "anyOf", "oneOf", "not", "if"/"then"/"else", "type", "enum",
+// "const" and the validation keywords for numbers, strings, arrays and objects. Formats are not
+// asserted. Other keywords of the draft, such as "unevaluatedProperties", "propertyNames" or
+// "$dynamicRef", are rejected with an error naming the keyword.
+func LoadSchema(fileName string) (*Schema, error) {
+  value,err := readJsonFromFile(fileName)
+  if err != nil {
+    return nil,err
+  }
+
+  root,ok := value.(map[string]interface{})
+  if !ok {
+    return nil,fmt.Errorf("Expected a schema object in '%s', got %s", fileName, jsonTypeName(value))
+  }
+
+  s,err := newSchemaSpec(root)
+  if err != nil {
+    return nil,err
+  }
+  return &Schema{spec: s},nil
+}
+
+// Validate checks an unmarshalled JSON value against the schema. Returns SchemaErrors listing
+// every value that does not satisfy it.
+func (s *Schema) Validate(value interface{}) error {
+  errs := SchemaErrors{}
+  s.spec.validate(s.spec.root, value, Path{}, 0, &errs)
+
+  if len(errs) > 0 {
+    return errs
+  }
+  return nil
+}
+
+// isSchema determines if an unmarshalled filter is a JSON Schema.
+func isSchema(filters interface{}) bool {
+  m,ok := filters.(map[string]interface{})
+  if ok {
+    _,ok = m[schemaKeyword]
+  }
+  return ok
+}
+
+// readSchemaFile reads a filter file and returns it as a schema if it is one.
+func readSchemaFile(fileName string) (*schemaSpec, bool, error) {
+  value,err := readJsonFromFile(fileName)
+  if err != nil || !isSchema(value) {
+    return nil,false,err
+  }
+
+  s,err := newSchemaSpec(value.(map[string]interface{}))
+  return s,true,err
+}
+
+// newSchemaSpec validates the filter keywords and references of a schema.
+func newSchemaSpec(root map[string]interface{}) (*schemaSpec, error) {
+  s := &schemaSpec{root: root, formats: map[string]string{}, patterns: map[string]*regexp.Regexp{}}
+  for format,command := range defaultSchemaFormats {
+    s.formats[format] = command
+  }
+
+  errs := ValidationErrors{}
+  if formats,ok := root[formatsKeyword]; ok {
+    if m,ok := formats.(map[string]interface{}); ok {
+      for _,format := range sortedKeys(m) {
+        validateRule(m[format], Path{Key(formatsKeyword), Key(format)}, &errs)
+        if command,ok := m[format].(string); ok {
+          s.formats[format] = command
+        }
+      }
+    } else {
+      errs = append(errs, &ValidationError{Path: Path{Key(formatsKeyword)}, Message: fmt.Sprintf("expected an object of commands, got %s", jsonTypeName(formats))})
+    }
+  }
+  s.validateKeywords(root, Path{}, &errs)
+  if len(errs) == 0 {
+    if err := s.checkRefCycles(root, Path{}, map[uintptr]int{}); err != nil {
+      errs = append(errs, err)
+    }
+  }
+
+  if len(errs) > 0 {
+    return nil,errs
+  }
+  return s,nil
+}
+
+// validateKeywords checks every "x-filter" keyword and "$ref" found in a schema and rejects the
+// keywords that are not supported. The path is the location within the schema.
+func (s *schemaSpec) validateKeywords(node interface{}, path Path, errs *ValidationErrors) {
+  switch n := node.(type) {
+  case map[string]interface{}:
+    for _,k := range sortedKeys(n) {
+      switch k {
+      case filterKeyword:
+        if _,ok := n[k].(string); ok {
+          validateRule(n[k], path.Append(Key(k)), errs)
+        } else {
+          *errs = append(*errs, &ValidationError{Path: path.Append(Key(k)), Message: fmt.Sprintf("expected a command, got %s", jsonTypeName(n[k]))})
+        }
+      case "$ref":
+        if ref,ok := n[k].(string); !ok {
+          *errs = append(*errs, &ValidationError{Path: path.Append(Key(k)), Message: fmt.Sprintf("expected a reference, got %s", jsonTypeName(n[k]))})
+        } else if _,err := s.resolve(ref); err != nil {
+          *errs = append(*errs, &ValidationError{Path: path.Append(Key(k)), Message: err.Error()})
+        }
+      case "enum", "const", "required", "default", "examples", formatsKeyword:
+        // Data, not schemas.
+      case "properties", "patternProperties", "$defs", "definitions":
+        // The names of these schemas are not keywords.
+        if schemas,ok := n[k].(map[string]interface{}); ok {
+          for _,name := range sortedKeys(schemas) {
+            s.validateKeywords(schemas[name], path.Append(Key(k)).Append(Key(name)), errs)
+          }
+        } else {
+          s.validateKeywords(n[k], path.Append(Key(k)), errs)
+        }
+      default:
+        if unsupportedSchemaKeywords[k] {
+          *errs = append(*errs, &ValidationError{Path: path.Append(Key(k)), Message: fmt.Sprintf("unsupported keyword '%s'", k)})
+        } else {
+          s.validateKeywords(n[k], path.Append(Key(k)), errs)
+        }
+      }
+    }
+  case []interface{}:
+    for k,v := range n {
+      s.validateKeywords(v, path.Append(Index(k)), errs)
+    }
+  }
+}
+
+// checkRefCycles returns an error for the first schema whose "$ref" leads back to it without
+// descending into the data, since the schemas would be applied to the same value forever.
+// States records the schemas already checked by refCycle.
+func (s *schemaSpec) checkRefCycles(node interface{}, path Path, states map[uintptr]int) *ValidationError {
+  switch n := node.(type) {
+  case map[string]interface{}:
+    if s.refCycle(n, states) {
+      return &ValidationError{Path: path, Message: "a $ref cycle never descends into the data"}
+    }
+    for _,k := range sortedKeys(n) {
+      switch k {
+      case "enum", "const", "required", filterKeyword, formatsKeyword:
+        // Data, not schemas.
+      default:
+        if err := s.checkRefCycles(n[k], path.Append(Key(k)), states); err != nil {
+          return err
+        }
+      }
+    }
+  case []interface{}:
+    for k,v := range n {
+      if err := s.checkRefCycles(v, path.Append(Index(k)), states); err != nil {
+        return err
+      }
+    }
+  }
+  return nil
+}
+
+// Schema states of refCycle.
+const (
+  schemaChecking = 1
+  schemaChecked = 2
+)
+
+// refCycle determines if a schema reaches itself through "$ref" and the keywords that apply
+// subschemas to the same value.
+func (s *schemaSpec) refCycle(node interface{}, states map[uintptr]int) bool {
+  m,ok := node.(map[string]interface{})
+  if !ok {
+    return false
+  }
+
+  id := reflect.ValueOf(m).Pointer()
+  switch states[id] {
+  case schemaChecking: return true
+  case schemaChecked: return false
+  }
+  states[id] = schemaChecking
+
+  subs := []interface{}{}
+  if ref,ok := m["$ref"].(string); ok {
+    if target,err := s.resolve(ref); err == nil {
+      subs = append(subs, target)
+    }
+  }
+  for _,k := range []string{"allOf", "anyOf", "oneOf"} {
+    subs = append(subs, schemaList(m[k])...)
+  }
+  for _,k := range []string{"not", "if", "then", "else"} {
+    if sub,ok := m[k]; ok {
+      subs = append(subs, sub)
+    }
+  }
+
+  for _,sub := range subs {
+    if s.refCycle(sub, states) {
+      return true
+    }
+  }
+  states[id] = schemaChecked
+  return false
+}
+
+// resolve returns the schema a "$ref" refers to. Only references within the schema are supported,
+// written as a JSON Pointer fragment such as "#/$defs/address".
+func (s *schemaSpec) resolve(ref string) (interface{}, error) {
+  if !strings.HasPrefix(ref, "#") {
+    return nil,fmt.Errorf("unsupported reference '%s', only references within the schema such as '#/$defs/name' are supported", ref)
+  }
+
+  var node interface{} = s.root
+  pointer,err := url.PathUnescape(ref[1:])
+  if err != nil {
+    return nil,fmt.Errorf("invalid reference '%s'", ref)
+  } else if pointer == "" {
+    return node,nil
+  } else if !strings.HasPrefix(pointer, "/") {
+    return nil,fmt.Errorf("unsupported reference '%s', expected a JSON Pointer after '#'", ref)
+  }
+
+  for _,token := range strings.Split(pointer[1:], "/") {
+    token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+    switch n := node.(type) {
+    case map[string]interface{}:
+      node = n[token]
+    case []interface{}:
+      var k int
+      if _,err := fmt.Sscanf(token, "%d", &k); err == nil && k >= 0 && k < len(n) {
+        node = n[k]
+      } else {
+        node = nil
+      }
+    default:
+      node = nil
+    }
+    if node == nil {
+      return nil,fmt.Errorf("unresolved reference '%s'", ref)
+    }
+  }
+
+  return node,nil
+}
+
+// commands resolves the schema against a document and returns the command for every value
+// the schema filters, keyed by the JSON Pointer of the value.
+func (s *schemaSpec) commands(data interface{}) map[string]string {
+  commands := map[string]string{}
+  s.collect(s.root, data, Path{}, 0, commands)
+  return commands
+}
+
+// collect records the commands that a schema node applies to data and its descendants. An
+// "x-filter" keyword applies to the value and everything beneath it. Otherwise the subschemas of
+// "$ref", "allOf", the "anyOf" branches the data is valid against, the first valid "oneOf" branch
+// and "if"/"then"/"else" are applied in turn, then properties and items are descended into.
+func (s *schemaSpec) collect(node interface{}, data interface{}, path Path, depth int, commands map[string]string) {
+  m,ok := node.(map[string]interface{})
+  if !ok || depth > maxSchemaDepth {
+    return
+  }
+
+  if command,ok := m[filterKeyword].(string); ok {
+    switch data.(type) {
+    case string, map[string]interface{}, []interface{}:
+      commands[path.Pointer()] = command
+    }
+    return
+  }
+
+  if ref,ok := m["$ref"].(string); ok {
+    if target,err := s.resolve(ref); err == nil {
+      s.collect(target, data, path, depth + 1, commands)
+    }
+  }
+  for _,sub := range schemaList(m["allOf"]) {
+    s.collect(sub, data, path, depth + 1, commands)
+  }
+  for _,sub := range schemaList(m["anyOf"]) {
+    if s.valid(sub, data, depth + 1) {
+      s.collect(sub, data, path, depth + 1, commands)
+    }
+  }
+  for _,sub := range schemaList(m["oneOf"]) {
+    if s.valid(sub, data, depth + 1) {
+      s.collect(sub, data, path, depth + 1, commands)
+      break
+    }
+  }
+  if cond,ok := m["if"]; ok {
+    if s.valid(cond, data, depth + 1) {
+      s.collect(m["then"], data, path, depth + 1, commands)
+    } else {
+      s.collect(m["else"], data, path, depth + 1, commands)
+    }
+  }
+
+  switch d := data.(type) {
+  case string:
+    pointer := path.Pointer()
+    if format,ok := m["format"].(string); ok {
+      if command,ok := s.formats[format]; ok {
+        if _,set := commands[pointer]; !set {
+          commands[pointer] = command
+        }
+      }
+    }
+  case map[string]interface{}:
+    for k,v := range d {
+      for _,sub := range s.propertySchemas(m, k) {
+        s.collect(sub, v, path.Append(Key(k)), 0, commands)
+      }
+    }
+  case []interface{}:
+    for k,v := range d {
+      if sub := itemSchema(m, k); sub != nil {
+        s.collect(sub, v, path.Append(Index(k)), 0, commands)
+      }
+    }
+  }
+}
+
+// propertySchemas returns the schemas that apply to the property key of an object: the schema in
+// "properties" and those in "patternProperties" whose pattern matches, or "additionalProperties"
+// when there are none.
+func (s *schemaSpec) propertySchemas(m map[string]interface{}, key string) []interface{} {
+  schemas := []interface{}{}
+  if properties,ok := m["properties"].(map[string]interface{}); ok {
+    if sub,ok := properties[key]; ok {
+      schemas = append(schemas, sub)
+    }
+  }
+  if patterns,ok := m["patternProperties"].(map[string]interface{}); ok {
+    for _,pattern := range sortedKeys(patterns) {
+      if re := s.pattern(pattern); re != nil && re.MatchString(key) {
+        schemas = append(schemas, patterns[pattern])
+      }
+    }
+  }
+  if len(schemas) == 0 {
+    if sub,ok := m["additionalProperties"]; ok {
+      schemas = append(schemas, sub)
+    }
+  }
+  return schemas
+}
+
+// itemSchema returns the schema of an array item: the positional schema in "prefixItems" (or an
+// array of "items", as in earlier drafts) and otherwise the schema in "items".
+func itemSchema(m map[string]interface{}, index int) interface{} {
+  prefix,ok := m["prefixItems"].([]interface{})
+  if !ok {
+    if items,ok := m["items"].([]interface{}); ok {
+      if index < len(items) {
+        return items[index]
+      }
+      return m["additionalItems"]
+    }
+  }
+  if index < len(prefix) {
+    return prefix[index]
+  }
+  return m["items"]
+}
+
+func schemaList(value interface{}) []interface{} {
+  list,_ := value.([]interface{})
+  return list
+}
+
+// pattern compiles a regular expression of the schema once. Returns nil if it is invalid.
+func (s *schemaSpec) pattern(pattern string) *regexp.Regexp {
+  s.mutex.Lock()
+  defer s.mutex.Unlock()
+
+  re,ok := s.patterns[pattern]
+  if !ok {
+    re,_ = regexp.Compile(pattern)
+    s.patterns[pattern] = re
+  }
+  return re
+}
+
+// valid determines if data satisfies a schema. Depth is the number of schemas already applied to
+// data, so that a $ref cycle through a branch still stops at maxSchemaDepth.
+func (s *schemaSpec) valid(node interface{}, data interface{}, depth int) bool {
+  errs := SchemaErrors{}
+  s.validate(node, data, Path{}, depth, &errs)
+  return len(errs) == 0
+}
+
+// validate checks data against a schema node and records every value that does not satisfy it. A subset of JSON
+// Schema draft 2020-12 is supported: the applicators, type, enum, const and the validation
+// keywords for numbers, strings, arrays and objects. Formats are annotations only.
+func (s *schemaSpec) validate(node interface{}, data interface{}, path Path, depth int, errs *SchemaErrors) {
+  fail := func (format string, args ...interface{}) {
+    *errs = append(*errs, &SchemaError{Path: path, Message: fmt.Sprintf(format, args...)})
+  }
+
+  m,ok := node.(map[string]interface{})
+  if b,isBool := node.(bool); isBool && !b {
+    fail("no value is allowed here")
+    return
+  } else if !ok {
+    return
+  } else if depth > maxSchemaDepth {
+    fail("too many nested schemas, is there a $ref cycle?")
+    return
+  }
+
+  if ref,ok := m["$ref"].(string); ok {
+    if target,err := s.resolve(ref); err == nil {
+      s.validate(target, data, path, depth + 1, errs)
+    } else {
+      fail("%s", err.Error())
+    }
+  }
+
+  if t,ok := m["type"]; ok && !schemaTypeMatches(t, data) {
+    fail("expected %s, got %s", schemaTypeNames(t), jsonTypeName(data))
+    return
+  }
+  if enum,ok := m["enum"].([]interface{}); ok {
+    found := false
+    for _,v := range enum {
+      found = found || reflect.DeepEqual(v, data)
+    }
+    if !found {
+      fail("expected one of the enumerated values")
+    }
+  }
+  if c,ok := m["const"]; ok && !reflect.DeepEqual(c, data) {
+    fail("expected the constant value")
+  }
+
+  for _,sub := range schemaList(m["allOf"]) {
+    s.validate(sub, data, path, depth + 1, errs)
+  }
+  if branches := schemaList(m["anyOf"]); len(branches) > 0 {
+    found := false
+    for _,sub := range branches {
+      found = found || s.valid(sub, data, depth + 1)
+    }
+    if !found {
+      fail("expected a value valid against at least one schema of anyOf")
+    }
+  }
+  if branches := schemaList(m["oneOf"]); len(branches) > 0 {
+    count := 0
+    for _,sub := range branches {
+      if s.valid(sub, data, depth + 1) {
+        count++
+      }
+    }
+    if count != 1 {
+      fail("expected a value valid against exactly one schema of oneOf, valid against %d", count)
+    }
+  }
+  if not,ok := m["not"]; ok && s.valid(not, data, depth + 1) {
+    fail("expected a value not valid against the schema of not")
+  }
+  if cond,ok := m["if"]; ok {
+    if s.valid(cond, data, depth + 1) {
+      s.validate(m["then"], data, path, depth + 1, errs)
+    } else {
+      s.validate(m["else"], data, path, depth + 1, errs)
+    }
+  }
+
+  switch d := data.(type) {
+  case float64:
+    if min,ok := m["minimum"].(float64); ok && d < min {
+      fail("expected a number of at least %v, got %v", min, d)
+    }
+    if max,ok := m["maximum"].(float64); ok && d > max {
+      fail("expected a number of at most %v, got %v", max, d)
+    }
+    if min,ok := m["exclusiveMinimum"].(float64); ok && d <= min {
+      fail("expected a number greater than %v, got %v", min, d)
+    }
+    if max,ok := m["exclusiveMaximum"].(float64); ok && d >= max {
+      fail("expected a number less than %v, got %v", max, d)
+    }
+    if divisor,ok := m["multipleOf"].(float64); ok && divisor > 0 {
+      if q := d / divisor; math.Abs(q - math.Round(q)) > 1e-9 {
+        fail("expected a multiple of %v, got %v", divisor, d)
+      }
+    }
+  case string:
+    length := float64(utf8.RuneCountInString(d))
+    if min,ok := m["minLength"].(float64); ok && length < min {
+      fail("expected a string of at least %v characters, got %v", min, length)
+    }
+    if max,ok := m["maxLength"].(float64); ok && length > max {
+      fail("expected a string of at most %v characters, got %v", max, length)
+    }
+    if pattern,ok := m["pattern"].(string); ok {
+      if re := s.pattern(pattern); re == nil {
+        fail("invalid pattern '%s'", pattern)
+      } else if !re.MatchString(d) {
+        fail("expected a string matching '%s'", pattern)
+      }
+    }
+  case []interface{}:
+    count := float64(len(d))
+    if min,ok := m["minItems"].(float64); ok && count < min {
+      fail("expected at least %v items, got %v", min, count)
+    }
+    if max,ok := m["maxItems"].(float64); ok && count > max {
+      fail("expected at most %v items, got %v", max, count)
+    }
+    if unique,_ := m["uniqueItems"].(bool); unique {
+      for i := range d {
+        for j := i + 1; j < len(d); j++ {
+          if reflect.DeepEqual(d[i], d[j]) {
+            fail("expected unique items, items %d and %d are equal", i, j)
+          }
+        }
+      }
+    }
+    if contains,ok := m["contains"]; ok {
+      found := false
+      for _,v := range d {
+        // Items are nested in data, so the depth starts over as it does for properties.
+        found = found || s.valid(contains, v, 0)
+      }
+      if !found {
+        fail("expected an item valid against the schema of contains")
+      }
+    }
+    for k,v := range d {
+      if sub := itemSchema(m, k); sub != nil {
+        s.validate(sub, v, path.Append(Index(k)), 0, errs)
+      }
+    }
+  case map[string]interface{}:
+    count := float64(len(d))
+    if min,ok := m["minProperties"].(float64); ok && count < min {
+      fail("expected at least %v properties, got %v", min, count)
+    }
+    if max,ok := m["maxProperties"].(float64); ok && count > max {
+      fail("expected at most %v properties, got %v", max, count)
+    }
+    for _,v := range schemaList(m["required"]) {
+      if key,ok := v.(string); ok {
+        if _,ok := d[key]; !ok {
+          fail("missing required property '%s'", key)
+        }
+      }
+    }
+    for _,k := range sortedKeys(d) {
+      for _,sub := range s.propertySchemas(m, k) {
+        s.validate(sub, d[k], path.Append(Key(k)), 0, errs)
+      }
+    }
+  }
+}
+
+// schemaTypeMatches determines if data is of the type, or one of the types, of a "type" keyword.
+func schemaTypeMatches(t interface{}, data interface{}) bool {
+  names := []interface{}{t}
+  if list,ok := t.([]interface{}); ok {
+    names = list
+  }
+
+  actual := jsonTypeName(data)
+  for _,name := range names {
+    if name == actual {
+      return true
+    } else if n,ok := data.(float64); ok && name == "integer" && n == math.Trunc(n) {
+      return true
+    }
+  }
+  return false
+}
+
+func schemaTypeNames(t interface{}) string {
+  if list,ok := t.([]interface{}); ok {
+    names := make([]string, len(list))
+    for k,v := range list {
+      names[k] = fmt.Sprint(v)
+    }
+    return strings.Join(names, " or ")
+  }
+  return fmt.Sprint(t)
+}
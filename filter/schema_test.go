@@ -0,0 +1,155 @@
+package filter
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const schemaJson = `{"name": "Darren", "email": "d@x.io", "home": {"street": "1 Main St", "city": "Springfield"}, "contacts": [{"kind": "phone", "value": "555-0100"}, {"kind": "note", "value": "call after 5"}], "secret": {"a": "b", "c": ["d"]}, "other": "o"}`
+
+func TestSchema_filters(t *testing.T) {
+	expectedJson := `{"contacts":[{"kind":"phone","value":"phone(555-0100)"},{"kind":"note","value":"call after 5"}],"email":"mail(d@x.io)","home":{"city":"Springfield","street":"street(1 Main St)"},"name":"name(Darren)","other":"o","secret":{"a":"redact(b)","c":["redact(d)"]}}`
+	options := Options{FilterRunner: commandFilterRunner}
+
+	if value,err := FilterJsonFromTextWithOptions(schemaJson, "./fixtures/schema-filter.json", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if b,_ := json.Marshal(value); string(b) != expectedJson {
+		t.Fatalf("Expected %v got %v", expectedJson, string(b))
+	}
+
+	expectedJson = `{"name":"name(Darren)","email":"mail(d@x.io)","home":{"street":"street(1 Main St)","city":"Springfield"},"contacts":[{"kind":"phone","value":"phone(555-0100)"},{"kind":"note","value":"call after 5"}],"secret":{"a":"redact(b)","c":["redact(d)"]},"other":"o"}`
+	if data,err := FilterBytesWithOptions([]byte(schemaJson), "./fixtures/schema-filter.json", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if string(data) != expectedJson {
+		t.Fatalf("Expected %v got %v", expectedJson, string(data))
+	}
+}
+
+func TestSchema_defaultFormats(t *testing.T) {
+	schema,err := newSchemaSpec(map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"items": map[string]interface{}{"format": "email"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+
+	commands := schema.commands([]interface{}{"d@x.io", 1.0})
+	if len(commands) != 1 || commands["/0"] != "builtin:fake:email" {
+		t.Fatalf("Expected the default email command got %v", commands)
+	}
+}
+
+func TestSchema_validation(t *testing.T) {
+	_,err := newSchemaSpec(map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"properties": map[string]interface{}{
+			"a": map[string]interface{}{"x-filter": 1.0},
+			"b": map[string]interface{}{"$ref": "#/$defs/missing"},
+			"c": map[string]interface{}{"$ref": "other.json#/a"},
+			"d": map[string]interface{}{"x-filter": "builtin:nope"},
+		},
+	})
+
+	errs,ok := err.(ValidationErrors)
+	if !ok || len(errs) != 4 {
+		t.Fatalf("Expected 4 validation errors got %v", err)
+	}
+}
+
+func TestSchema_validate(t *testing.T) {
+	schema,_ := newSchemaSpec(map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"required": []interface{}{"id"},
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{"type": "integer", "minimum": 1.0},
+			"tags": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "maxLength": 3.0}},
+		},
+	})
+
+	if !schema.valid(schema.root, map[string]interface{}{"id": 2.0, "tags": []interface{}{"abc"}}, 0) {
+		t.Fatalf("Expected the document to be valid")
+	}
+
+	errs := SchemaErrors{}
+	schema.validate(schema.root, map[string]interface{}{"id": 0.5, "tags": []interface{}{"abcd"}}, Path{}, 0, &errs)
+	if len(errs) != 2 || errs[0].Path.Pointer() != "/id" || errs[1].Path.Pointer() != "/tags/0" {
+		t.Fatalf("Expected errors at /id and /tags/0 got %v", errs)
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	schema,err := LoadSchema("./fixtures/output-schema.json")
+	if err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+
+	if value,err := readJsonFromText(`{"id": 1, "email": "a@example.com", "tags": ["x"]}`); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if err = schema.Validate(value); err != nil {
+		t.Fatalf("Expected the document to be valid :: %v", err.Error())
+	}
+
+	value,_ := readJsonFromText(`{"id": "1", "email": "", "tags": ["x", "x"], "extra": true}`)
+	errs,ok := schema.Validate(value).(SchemaErrors)
+	if !ok || len(errs) != 4 {
+		t.Fatalf("Expected 4 schema errors got %v", errs)
+	}
+	expected := []string{"/email", "/extra", "/id", "/tags"}
+	for k,e := range errs {
+		if e.Path.Pointer() != expected[k] {
+			t.Fatalf("Expected an error at %v got %v", expected[k], e)
+		}
+	}
+}
+
+func TestSchema_refCycles(t *testing.T) {
+	var cycle map[string]interface{}
+	json.Unmarshal([]byte(`{"$schema": "x", "anyOf": [{"$ref": "#"}], "properties": {"a": {"x-filter": "upper"}}}`), &cycle)
+
+	if _,err := newSchemaSpec(cycle); err == nil {
+		t.Fatalf("Expected a $ref cycle that never descends into the data to fail validation")
+	}
+	if _,err := FilterJsonFromTextWithOptions(`{"a": "hi"}`, "./fixtures/schema-cycle.json", Options{FilterRunner: commandFilterRunner}); err == nil {
+		t.Fatalf("Expected a filter file with a $ref cycle to fail")
+	}
+
+	// The depth limit still stops a cycle through a branch when the schema is not checked first.
+	unchecked := &schemaSpec{root: cycle, formats: map[string]string{}, patterns: map[string]*regexp.Regexp{}}
+	unchecked.commands(map[string]interface{}{"a": "hi"})
+	if err := (&Schema{spec: unchecked}).Validate(map[string]interface{}{"a": "hi"}); err == nil {
+		t.Fatalf("Expected the depth limit to fail validation")
+	}
+
+	var tree map[string]interface{}
+	json.Unmarshal([]byte(`{"$schema": "x", "properties": {"name": {"x-filter": "upper"}, "child": {"anyOf": [{"$ref": "#"}]}}}`), &tree)
+	if schema,err := newSchemaSpec(tree); err != nil {
+		t.Fatalf("Expected a $ref cycle through properties to be allowed :: %v", err.Error())
+	} else if commands := schema.commands(map[string]interface{}{"name": "a", "child": map[string]interface{}{"name": "b"}}); commands["/child/name"] != "upper" {
+		t.Fatalf("Expected the recursive schema to filter nested values got %v", commands)
+	}
+}
+
+func TestSchema_unsupportedKeywords(t *testing.T) {
+	var schema map[string]interface{}
+	json.Unmarshal([]byte(`{"$schema": "x", "properties": {"a": {"propertyNames": {"pattern": "^x"}}}, "unevaluatedProperties": false}`), &schema)
+
+	if _,err := newSchemaSpec(schema); err == nil {
+		t.Fatalf("Expected unsupported keywords to fail validation")
+	} else if !strings.Contains(err.Error(), "unsupported keyword 'propertyNames'") || !strings.Contains(err.Error(), "unsupported keyword 'unevaluatedProperties'") {
+		t.Fatalf("Expected errors naming the unsupported keywords got %v", err.Error())
+	}
+	if _,err := LoadSchema("./fixtures/schema-unsupported.json"); err == nil || !strings.Contains(err.Error(), "unsupported keyword 'dependentRequired'") {
+		t.Fatalf("Expected LoadSchema to reject an unsupported keyword got %v", err)
+	}
+
+	// Property and definition names are not keywords.
+	var names map[string]interface{}
+	json.Unmarshal([]byte(`{"$schema": "x", "properties": {"propertyNames": {"type": "string"}}, "$defs": {"$anchor": {}}, "default": {"minContains": 1}}`), &names)
+	if _,err := newSchemaSpec(names); err != nil {
+		t.Fatalf("Expected names that look like keywords to be allowed :: %v", err.Error())
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "fmt"
+  "strings"
+)
+
+// spec is a loaded filter. Rules holds the path rules while the remaining fields hold
+// the reserved sections of a filter file. Reserved sections are the top-level keys of a
+// filter file that start with "$". The "$include" and "$profiles" sections are resolved
+// before a spec is created (see loadFilterFile).
+type spec struct {
+  rules interface{}
+  // allow lists the JSONPath patterns of string values that may pass through unfiltered
+  // when a default action is set. Read from the "$allow" section.
+  allow []string
+  // arrayLengths is set when an array rule counts from the end of an array, so the length of
+  // every array must be known while filtering.
+  arrayLengths bool
+  // schema is set when the filter file is a JSON Schema. Its commands depend on the document and
+  // are resolved into commands before filtering (see forDocument).
+  schema *schemaSpec
+  // commands holds the command of every value a schema filters, keyed by JSON Pointer.
+  commands map[string]string
+}
+
+const allowSection = "$allow"
+
+const (
+  // defaultRule is the rule used for anything no other rule at the same level matches.
+  defaultRule = "$default"
+  // wildcardKey is a key of an object of rules that matches any key.
+  wildcardKey = "*"
+  // descentPrefix starts a key of an object of rules that matches the rest of the key at any depth.
+  descentPrefix = ".."
+)
+
+func loadFilters(filter string, profile string) (*spec, error) {
+  if isFilterFile(filter) {
+    if schema,ok,err := readSchemaFile(filter); err != nil {
+      return nil,err
+    } else if ok && profile != "" {
+      return nil,fmt.Errorf("Profile '%s' requires a filter file that is not a schema", profile)
+    } else if ok {
+      return &spec{schema: schema},nil
+    }
+
+    if filters,err := loadFilterFile(filter, profile); err == nil {
+      return newSpec(filters)
+    } else {
+      return nil,err
+    }
+  } else if profile != "" {
+    return nil,fmt.Errorf("Profile '%s' requires a filter file", profile)
+  }
+
+  return newSpec(filter)
+}
+
+// isFilterFile determines if a filter is the path of a filter file rather than a command.
+func isFilterFile(filter string) bool {
+  return strings.HasSuffix(filter, ".json")
+}
+
+// newSpec validates unmarshalled filters and separates the path rules from the reserved sections.
+func newSpec(filters interface{}) (*spec, error) {
+  if err := ValidateFilters(filters); err != nil {
+    return nil,err
+  }
+
+  s := &spec{rules: filters}
+
+  if m,ok := filters.(map[string]interface{}); ok {
+    rules := map[string]interface{}{}
+    for k,v := range m {
+      if k == allowSection {
+        for _,pattern := range v.([]interface{}) {
+          s.allow = append(s.allow, pattern.(string))
+        }
+      } else {
+        rules[k] = v
+      }
+    }
+    s.rules = rules
+  }
+  s.arrayLengths = needsArrayLengths(s.rules)
+
+  return s,nil
+}
+
+// forDocument returns the spec to filter a document with. For a schema the commands are resolved
+// against the document, any other spec is returned as-is.
+func (s *spec) forDocument(document interface{}) *spec {
+  if s.schema == nil {
+    return s
+  }
+  return &spec{allow: s.allow, commands: s.schema.commands(document)}
+}
+
+// command returns the command and output mode for the string value at path and the location of
+// the rule they come from. A schema command applies to the value it was resolved for and
+// everything beneath it.
+func (s *spec) command(path Path) (string, OutputMode, Path, bool) {
+  if s.commands == nil {
+    if filterRule,rule,found := getFilterRule(path, s.rules); found {
+      command,mode,_ := ruleCommand(filterRule)
+      return command,mode,rule,true
+    }
+    return "",OutputString,nil,false
+  }
+
+  for k := len(path); k >= 0; k-- {
+    if command,ok := s.commands[path[:k].Pointer()]; ok {
+      return command,OutputString,path[:k],true
+    }
+  }
+  return "",OutputString,nil,false
+}
+
+// allowed determines if the string value at path is listed in the allow section. A pattern
+// allows the value at its own path and every value beneath it.
+func (s *spec) allowed(path Path) bool {
+  pattern := path.Pattern()
+  exact := path.JSONPath()
+
+  for _,allow := range s.allow {
+    if matchesPathPrefix(pattern, allow) || matchesPathPrefix(exact, allow) {
+      return true
+    }
+  }
+
+  return false
+}
+
+func matchesPathPrefix(path string, prefix string) bool {
+  if !strings.HasPrefix(path, prefix) {
+    return false
+  }
+
+  rest := path[len(prefix):]
+  return len(rest) == 0 || rest[0] == '.' || rest[0] == '['
+}
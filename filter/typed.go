@@ -0,0 +1,292 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "encoding"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "reflect"
+  "sort"
+  "strings"
+)
+
+var (
+  jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+  textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// FilterInto decodes JSON data from a reader into a value of type T and filters every string
+// found in it. See FilterValue for how Go values are traversed and FilterJsonFromText for
+// details on the filter argument.
+func FilterInto[T any](reader io.Reader, filter string) (T, error) {
+  return FilterIntoWithOptions[T](reader, filter, Options{})
+}
+
+// FilterIntoWithOptions decodes JSON data from a reader into a value of type T and filters every
+// string found in it using the specified options. See FilterInto.
+func FilterIntoWithOptions[T any](reader io.Reader, filter string, options Options) (value T, err error) {
+  reader = options.Limits.Reader(reader)
+  if err = json.NewDecoder(reader).Decode(&value); err == nil || err == io.EOF {
+    _,err = FilterValueWithOptions(&value, filter, options)
+  }
+  return value,inputError(reader, err)
+}
+
+// FilterValue filters every string found in a Go value in place. Value must be a pointer.
+// Structs, maps with string keys, slices, arrays, pointers and interfaces are traversed the same
+// way encoding/json would encode them, so filter paths match struct fields by their json tag names.
+// Values whose type implements json.Marshaler or encoding.TextMarshaler are left as-is.
+func FilterValue(value interface{}, filter string) error {
+  _,err := FilterValueWithOptions(value, filter, Options{})
+  return err
+}
+
+// FilterValueWithOptions filters every string found in a Go value in place using the specified
+// options and returns a JSON Patch of the modifications. Deleted struct fields and array items are
+// set to their zero value, deleted map entries and slice items are removed.
+func FilterValueWithOptions(value interface{}, filter string, options Options) (patch Patch, err error) {
+  var (
+    f *Filter
+    document interface{}
+  )
+
+  v := reflect.ValueOf(value)
+  if v.Kind() != reflect.Ptr || v.IsNil() {
+    return nil,errors.New("FilterValue requires a non-nil pointer")
+  }
+
+  if f,err = Compile(filter, options); err != nil {
+    return
+  } else if f.filters.schema != nil {
+    // A schema resolves its commands against the document as encoding/json would encode it.
+    if document,err = encodeDocument(value); err != nil {
+      return
+    }
+  }
+
+  run := f.newRun(document)
+  if _,err = traverseReflect(v, Path{}, f.options.Limits, run.visit); err == nil {
+    patch,err = run.finish()
+  }
+
+  return
+}
+
+func encodeDocument(value interface{}) (document interface{}, err error) {
+  var data []byte
+  if data,err = json.Marshal(value); err == nil {
+    err = json.Unmarshal(data, &document)
+  }
+  return
+}
+
+// traverseReflect visits every string in v. Structs, maps, slices and arrays count against the
+// depth limit as the objects and arrays encoding/json would encode them. Returns true when the
+// visitor removed v.
+func traverseReflect(v reflect.Value, path Path, limits Limits, visit visitorFunc) (bool, error) {
+  if !v.IsValid() {
+    return false,nil
+  }
+
+  t := v.Type()
+  if t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && (t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType)) {
+    return false,nil
+  }
+
+  switch v.Kind() {
+  case reflect.Ptr:
+    if v.IsNil() {
+      return false,nil
+    }
+    return traverseReflect(v.Elem(), path, limits, visit)
+  case reflect.Interface:
+    if v.IsNil() {
+      return false,nil
+    }
+    // The value held by an interface is not addressable, so traverse a copy and store it back.
+    elem := reflect.New(v.Elem().Type()).Elem()
+    elem.Set(v.Elem())
+    if elem.Kind() == reflect.String && v.CanSet() {
+      return setReflectInterface(v, elem, path, visit)
+    }
+    if remove,err := traverseReflect(elem, path, limits, visit); remove || err != nil {
+      return remove,err
+    }
+    if v.CanSet() {
+      v.Set(elem)
+    }
+  case reflect.String:
+    result,err := visit(path, v.String())
+    if err != nil || result == removed {
+      return result == removed,err
+    }
+    return false,setReflectString(v, result, path)
+  case reflect.Struct:
+    if err := limits.checkNesting(path); err != nil {
+      return false,err
+    }
+    for _,field := range jsonFields(t) {
+      f,ok := fieldByIndex(v, field.index)
+      if !ok {
+        continue
+      }
+      if remove,err := traverseReflect(f, path.Append(Key(field.name)), limits, visit); err != nil {
+        return false,err
+      } else if remove && f.CanSet() {
+        f.Set(reflect.Zero(f.Type()))
+      }
+    }
+  case reflect.Map:
+    if t.Key().Kind() != reflect.String || v.IsNil() {
+      return false,nil
+    }
+    if err := limits.checkNesting(path); err != nil {
+      return false,err
+    }
+    keys := v.MapKeys()
+    sort.Slice(keys, func (i, j int) bool { return keys[i].String() < keys[j].String() })
+    for _,k := range keys {
+      elem := reflect.New(t.Elem()).Elem()
+      elem.Set(v.MapIndex(k))
+      if remove,err := traverseReflect(elem, path.Append(Key(k.String())), limits, visit); err != nil {
+        return false,err
+      } else if remove {
+        v.SetMapIndex(k, reflect.Value{})
+      } else {
+        v.SetMapIndex(k, elem)
+      }
+    }
+  case reflect.Slice:
+    // Byte slices are encoded as base64 strings by encoding/json and are left as-is.
+    if t.Elem().Kind() == reflect.Uint8 || v.IsNil() {
+      return false,nil
+    } else if err := limits.checkNesting(path); err != nil {
+      return false,err
+    }
+    kept := []int{}
+    for k := 0; k < v.Len(); k++ {
+      if remove,err := traverseReflect(v.Index(k), path.Append(arrayIndex(k, v.Len())), limits, visit); err != nil {
+        return false,err
+      } else if !remove {
+        kept = append(kept, k)
+      }
+    }
+    if len(kept) < v.Len() && v.CanSet() {
+      slice := reflect.MakeSlice(t, len(kept), len(kept))
+      for k,index := range kept {
+        slice.Index(k).Set(v.Index(index))
+      }
+      v.Set(slice)
+    }
+  case reflect.Array:
+    if err := limits.checkNesting(path); err != nil {
+      return false,err
+    }
+    for k := 0; k < v.Len(); k++ {
+      if remove,err := traverseReflect(v.Index(k), path.Append(arrayIndex(k, v.Len())), limits, visit); err != nil {
+        return false,err
+      } else if remove && v.Index(k).CanSet() {
+        v.Index(k).Set(reflect.Zero(t.Elem()))
+      }
+    }
+  }
+
+  return false,nil
+}
+
+func setReflectString(v reflect.Value, result interface{}, path Path) error {
+  if !v.CanSet() {
+    return fmt.Errorf("Cannot set the string value at %s", path)
+  }
+
+  switch result.(type) {
+  case string: v.SetString(result.(string))
+  default:
+    return fmt.Errorf("Cannot set the string value at %s to a %s", path, jsonTypeName(result))
+  }
+  return nil
+}
+
+// setReflectInterface visits the string held by an interface. Unlike a string, an interface can
+// hold the value of any type a filter with a typed output mode returns.
+func setReflectInterface(v reflect.Value, elem reflect.Value, path Path, visit visitorFunc) (bool, error) {
+  result,err := visit(path, elem.String())
+  if err != nil || result == removed {
+    return result == removed,err
+  }
+
+  if str,ok := result.(string); ok {
+    elem.SetString(str)
+    v.Set(elem)
+  } else if result == nil {
+    v.Set(reflect.Zero(v.Type()))
+  } else if r := reflect.ValueOf(result); r.Type().Implements(v.Type()) {
+    v.Set(r)
+  } else {
+    return false,fmt.Errorf("Cannot set the value at %s to a %s", path, jsonTypeName(result))
+  }
+  return false,nil
+}
+
+type jsonField struct {
+  name string
+  index []int
+}
+
+// jsonFields returns the fields of a struct type that encoding/json would encode, named by their
+// json tags. Untagged embedded structs have their fields promoted.
+func jsonFields(t reflect.Type) []jsonField {
+  fields := []jsonField{}
+
+  for k := 0; k < t.NumField(); k++ {
+    f := t.Field(k)
+    tag := f.Tag.Get("json")
+    if tag == "-" {
+      continue
+    }
+
+    name := strings.Split(tag, ",")[0]
+    ft := f.Type
+    if ft.Kind() == reflect.Ptr {
+      ft = ft.Elem()
+    }
+
+    if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+      for _,promoted := range jsonFields(ft) {
+        fields = append(fields, jsonField{promoted.name, append([]int{k}, promoted.index...)})
+      }
+      continue
+    } else if f.PkgPath != "" {
+      continue
+    }
+
+    if name == "" {
+      name = f.Name
+    }
+    fields = append(fields, jsonField{name, []int{k}})
+  }
+
+  return fields
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but reports false instead of panicking when
+// an embedded struct pointer is nil.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+  for k,i := range index {
+    if k > 0 {
+      if v.Kind() == reflect.Ptr {
+        if v.IsNil() {
+          return v,false
+        }
+        v = v.Elem()
+      }
+    }
+    v = v.Field(i)
+  }
+  return v,true
+}
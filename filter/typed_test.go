@@ -0,0 +1,125 @@
+package filter
+
+import (
+	"testing"
+	"strings"
+	"time"
+)
+
+type typedAddress struct {
+	Street string `json:"street"`
+	City string `json:"city"`
+}
+
+type typedMeta struct {
+	Source string `json:"source"`
+}
+
+type typedPerson struct {
+	typedMeta
+	Name string `json:"name"`
+	Nickname *string `json:"nick,omitempty"`
+	Tags []string `json:"tags"`
+	Address typedAddress `json:"address"`
+	Extra map[string]interface{} `json:"extra"`
+	Born time.Time `json:"born"`
+	Ignored string `json:"-"`
+	secret string
+}
+
+func TestFilterInto_structTags(t *testing.T) {
+	jsonText := `{"source": "crm", "name": "darren", "nick": "d", "tags": ["a", "b"], "address": {"street": "main", "city": "van"}, "extra": {"note": "hi", "n": 1}, "born": "2014-10-18T00:00:00Z"}`
+	filterRunner := func(command string, value string) (string, error) {
+		return strings.ToUpper(value),nil
+	}
+
+	person,err := FilterIntoWithOptions[typedPerson](strings.NewReader(jsonText), "./fixtures/typed-filter.json", Options{FilterRunner: filterRunner})
+	if err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+
+	if person.Source != "CRM" || person.Name != "DARREN" || *person.Nickname != "D" {
+		t.Fatalf("Expected tagged and promoted fields to be filtered :: %+v", person)
+	}
+	if person.Tags[0] != "A" || person.Tags[1] != "B" || person.Address.City != "VAN" || person.Address.Street != "main" {
+		t.Fatalf("Expected nested values to be filtered by path :: %+v", person)
+	}
+	if person.Extra["note"] != "HI" || person.Extra["n"] != float64(1) {
+		t.Fatalf("Expected map values to be filtered :: %+v", person.Extra)
+	}
+}
+
+type typedNested struct {
+	A struct {
+		B struct {
+			C struct {
+				D string `json:"d"`
+			} `json:"c"`
+		} `json:"b"`
+	} `json:"a"`
+}
+
+func TestFilterValue_depthLimit(t *testing.T) {
+	options := Options{FilterRunner: commandFilterRunner, Limits: Limits{Depth: 2}}
+
+	var value typedNested
+	value.A.B.C.D = "abc"
+	_,err := FilterValueWithOptions(&value, "f", options)
+	expectLimitError(t, err, LimitDepth, "/a/b")
+
+	_,err = FilterIntoWithOptions[typedNested](strings.NewReader(`{"a": {"b": {"c": {"d": "abc"}}}}`), "f", options)
+	expectLimitError(t, err, LimitDepth, "/a/b")
+
+	options.Limits.Depth = 4
+	if _,err = FilterValueWithOptions(&value, "f", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+}
+
+func TestFilterInto_defaultOptions(t *testing.T) {
+	person,err := FilterInto[typedPerson](strings.NewReader(`{"name": "x@y.io", "tags": ["a"]}`), "builtin:detect:email")
+	if err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	} else if person.Name != "[REDACTED:email]" || person.Tags[0] != "a" {
+		t.Fatalf("Expected every string to be filtered :: %+v", person)
+	}
+}
+
+func TestFilterValue_deleteAndPatch(t *testing.T) {
+	person := typedPerson{
+		Name: "darren",
+		Tags: []string{"keep", "drop", "keep"},
+		Ignored: "untouched",
+		secret: "untouched",
+		Extra: map[string]interface{}{"drop": "x"},
+	}
+	options := Options{
+		FilterRunner: func(command string, value string) (string, error) {
+			if value == "drop" {
+				return value,nil
+			}
+			return strings.ToUpper(value),nil
+		},
+		DefaultAction: ActionDelete,
+	}
+	filters := "./fixtures/typed-filter.json"
+
+	patch,err := FilterValueWithOptions(&person, filters, options)
+	if err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+
+	if person.Name != "DARREN" || len(person.Tags) != 3 || person.Tags[1] != "drop" || person.Ignored != "untouched" || person.secret != "untouched" {
+		t.Fatalf("Unexpected filtered value :: %+v", person)
+	}
+	if _,ok := person.Extra["drop"]; ok {
+		t.Fatalf("Expected unmatched map entries to be deleted")
+	}
+	if len(patch) == 0 || patch[len(patch) - 1].Op != "remove" {
+		t.Fatalf("Expected the patch to end with a removal :: %v", patch)
+	}
+
+	if err := FilterValue(person, filters); err == nil {
+		t.Fatalf("Expected an error for a non-pointer value")
+	}
+}
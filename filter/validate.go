@@ -0,0 +1,217 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package filter
+
+import (
+  "fmt"
+  "sort"
+  "strings"
+)
+
+// ValidationError describes a malformed or unreachable rule in a filter.
+// Path is the location of the rule within the filter, not within the JSON data.
+type ValidationError struct {
+  Path Path
+  Message string
+}
+
+func (e *ValidationError) Error() string {
+  return fmt.Sprintf("Invalid rule at %s :: %s", e.Path, e.Message)
+}
+
+// ValidationErrors is returned when a filter contains one or more invalid rules.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+  messages := make([]string, len(e))
+  for k,v := range e {
+    messages[k] = v.Error()
+  }
+  return strings.Join(messages, "\n")
+}
+
+// UnmatchedRulesError is returned in strict mode when rules in a filter never matched a string value.
+// Rules are the locations of each unmatched rule within the filter.
+type UnmatchedRulesError struct {
+  Rules []Path
+}
+
+func (e *UnmatchedRulesError) Error() string {
+  rules := make([]string, len(e.Rules))
+  for k,v := range e.Rules {
+    rules[k] = v.String()
+  }
+  return fmt.Sprintf("Rules never matched a string value :: %s", strings.Join(rules, ", "))
+}
+
+// Validate loads a filter and type-checks each of its rules. The filter can either be a command
+// or a path to a JSON file, in which case every included file is checked too and every profile
+// must extend known profiles. A filter file written as a JSON Schema has its "x-filter" keywords
+// and references checked. Returns ValidationErrors if any rule is malformed.
+func Validate(filter string) error {
+  if isFilterFile(filter) {
+    if _,ok,err := readSchemaFile(filter); err != nil || ok {
+      return err
+    }
+    return validateProfiles(filter)
+  }
+  return ValidateFilters(filter)
+}
+
+// ValidateFilters type-checks the rules of an unmarshalled filter. Every rule must be a non-empty
+// command string, a command rule, an object of rules or an array of rules. The "$allow" section
+// must be an array of JSONPath patterns, the "$include" section an array of filter files and the
+// "$profiles" section an object of named profiles. Returns ValidationErrors if any rule is malformed.
+func ValidateFilters(filters interface{}) error {
+  errs := ValidationErrors{}
+
+  if m,ok := filters.(map[string]interface{}); ok && len(m) > 0 {
+    for _,k := range sortedKeys(m) {
+      switch k {
+      case allowSection: validateAllowSection(m[k], Path{Key(k)}, &errs)
+      case includeSection: validateIncludeSection(m[k], Path{Key(k)}, &errs)
+      case profilesSection: validateProfilesSection(m[k], Path{Key(k)}, &errs)
+      case descentPrefix: errs = append(errs, &ValidationError{Path: Path{Key(k)}, Message: "expected a key after '..'"})
+      default: validateRule(m[k], Path{Key(k)}, &errs)
+      }
+    }
+  } else {
+    validateRule(filters, Path{}, &errs)
+  }
+
+  if len(errs) > 0 {
+    return errs
+  }
+  return nil
+}
+
+func validateRule(rule interface{}, path Path, errs *ValidationErrors) {
+  fail := func (format string, args ...interface{}) {
+    *errs = append(*errs, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+  }
+
+  // Unlike the "$default" selector of an array rule, the "$default" rule of an object applies to
+  // everything beneath the object and must be a command.
+  if n := len(path); n > 0 && path[n - 1] == Key(defaultRule) && (n < 2 || path[n - 2] != Key(arraySection)) {
+    if _,_,ok := ruleCommand(rule); !ok && !isCommandRule(rule) {
+      fail("expected a command, got %s", jsonTypeName(rule))
+      return
+    }
+  }
+
+  switch rule.(type) {
+  case string:
+    if command := rule.(string); len(strings.TrimSpace(command)) == 0 {
+      fail("expected a command, got an empty string")
+    } else if IsBuiltin(command) {
+      if err := validateBuiltin(command); err != nil {
+        fail("%s", err.Error())
+      }
+    }
+  case map[string]interface{}:
+    m := rule.(map[string]interface{})
+    if isCommandRule(m) {
+      validateCommandRule(m, path, errs)
+      return
+    } else if _,ok := m[arraySection]; ok {
+      validateArrayRule(m, path, errs)
+      return
+    } else if len(m) == 0 {
+      fail("object has no rules and can never match")
+    }
+    for _,k := range sortedKeys(m) {
+      if k == descentPrefix {
+        *errs = append(*errs, &ValidationError{Path: path.Append(Key(k)), Message: "expected a key after '..'"})
+        continue
+      }
+      validateRule(m[k], path.Append(Key(k)), errs)
+    }
+  case []interface{}:
+    s := rule.([]interface{})
+    if len(s) == 0 {
+      fail("array has no rules and can never match")
+    }
+    for k,v := range s {
+      validateRule(v, path.Append(Index(k)), errs)
+    }
+  case nil:
+    fail("expected a command, object or array, got null")
+  default:
+    fail("expected a command, object or array, got %s", jsonTypeName(rule))
+  }
+}
+
+func validateAllowSection(section interface{}, path Path, errs *ValidationErrors) {
+  patterns,ok := section.([]interface{})
+  if !ok {
+    *errs = append(*errs, &ValidationError{Path: path, Message: fmt.Sprintf("expected an array of JSONPath patterns, got %s", jsonTypeName(section))})
+    return
+  }
+
+  for k,v := range patterns {
+    if pattern,ok := v.(string); !ok || !strings.HasPrefix(pattern, "$") {
+      *errs = append(*errs, &ValidationError{Path: path.Append(Index(k)), Message: "expected a JSONPath pattern starting with '$'"})
+    }
+  }
+}
+
+// checkUnmatchedRules returns an UnmatchedRulesError listing every command in filters whose
+// location is not in matched.
+func checkUnmatchedRules(filters interface{}, matched map[string]bool) error {
+  unmatched := []Path{}
+
+  walkRules(filters, Path{}, func (rule Path, command string) {
+    if !matched[rule.Pointer()] {
+      unmatched = append(unmatched, rule)
+    }
+  })
+
+  if len(unmatched) > 0 {
+    return &UnmatchedRulesError{Rules: unmatched}
+  }
+  return nil
+}
+
+// walkRules calls visit for every command in filters along with its location. The location of a
+// command rule is the rule itself.
+func walkRules(filters interface{}, path Path, visit func (rule Path, command string)) {
+  switch filters.(type) {
+  case string: visit(path, filters.(string))
+  case map[string]interface{}:
+    m := filters.(map[string]interface{})
+    if command,_,ok := ruleCommand(m); ok {
+      visit(path, command)
+      return
+    }
+    for _,k := range sortedKeys(m) {
+      walkRules(m[k], path.Append(Key(k)), visit)
+    }
+  case []interface{}:
+    for k,v := range filters.([]interface{}) {
+      walkRules(v, path.Append(Index(k)), visit)
+    }
+  }
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+  keys := make([]string, 0, len(m))
+  for k := range m {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+func jsonTypeName(value interface{}) string {
+  switch value.(type) {
+  case nil: return "null"
+  case bool: return "boolean"
+  case float64: return "number"
+  case string: return "string"
+  case map[string]interface{}: return "object"
+  case []interface{}: return "array"
+  }
+  return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,62 @@
+package filter
+
+import (
+	"testing"
+	"strings"
+)
+
+func TestValidate_malformedRules(t *testing.T) {
+	expected := []string{
+		"$.b.c :: expected a command, object or array, got number",
+		"$.b.d :: array has no rules and can never match",
+		"$.b.e :: expected a command, object or array, got null",
+		"$.b.f :: expected a command, got an empty string",
+		"$.g[0] :: expected a command, object or array, got boolean",
+	}
+
+	err := Validate("./fixtures/invalid-filter.json")
+	if errs,ok := err.(ValidationErrors); !ok {
+		t.Fatalf("Expected ValidationErrors got %v", err)
+	} else if len(errs) != len(expected) {
+		t.Fatalf("Expected %v errors got %v :: %v", len(expected), len(errs), errs)
+	} else {
+		for k,v := range errs {
+			if got := v.Path.String() + " :: " + v.Message; got != expected[k] {
+				t.Fatalf("Expected error '%v' got '%v'", expected[k], got)
+			}
+		}
+	}
+
+	if err := Validate("./fixtures/filters.json"); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+}
+
+func TestFilterJsonFromReader_malformedFilterFails(t *testing.T) {
+	filterRunner := func(command string, value string) (string, error) {
+		return value,nil
+	}
+
+	if _,err := FilterJsonFromTextWithFilterRunner(`{"a": "x"}`, "./fixtures/invalid-filter.json", filterRunner); err == nil {
+		t.Fatalf("Expected an error for a malformed filter")
+	}
+}
+
+func TestFilterJsonFromReader_strict(t *testing.T) {
+	filterRunner := func(command string, value string) (string, error) {
+		return strings.ToUpper(value),nil
+	}
+	options := Options{FilterRunner: filterRunner, Strict: true}
+
+	_,err := FilterJsonFromTextWithOptions(`{"a": "x", "b": {"c": "y", "name": "z"}}`, "./fixtures/unmatched-filter.json", options)
+	if unmatched,ok := err.(*UnmatchedRulesError); !ok {
+		t.Fatalf("Expected an UnmatchedRulesError got %v", err)
+	} else if msg := unmatched.Error(); msg != "Rules never matched a string value :: $.b.nmae, $.missing[0], $.missing[1]" {
+		t.Fatalf("Unexpected error message :: %v", msg)
+	}
+
+	options.Strict = false
+	if _,err := FilterJsonFromTextWithOptions(`{"a": "x"}`, "./fixtures/unmatched-filter.json", options); err != nil {
+		t.Fatalf("Expected no error :: %v", err.Error())
+	}
+}
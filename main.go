@@ -11,11 +11,72 @@ the `--output` argument is not specified then output will be piped to
 standard out.
 
   jsonfilter "json to filter" | jsonfilter "file.json" | jsonfilter [help|/?]
+  jsonfilter validate "filter.json" ...
+  jsonfilter reverse [flags] "json to unfilter"
+  jsonfilter proxy -listen :8080 -upstream URL [flags]
+  jsonfilter serve -listen :8080 [-ruleset name=filter.json ...] [flags]
+    -cache=0: Cache up to this many filter results keyed by command and value. 0 disables the cache.
+    -cache-stats=false: Print cache hits, misses and evictions to stderr.
+    -default-action="pass": What to do with strings that no rule matched. One of pass, redact, delete or error.
     -filter="": The filter(s) to apply to the strings contained in the JSON file.
     -help=false: Show the help message.
+    -input-newline=false: Append a newline to each value piped to a filter command.
+    -key-file="": The file containing the key for the encryption built-in filters. Defaults to $JSONFILTER_KEY.
+    -mapping="": The file to write the pseudonym mapping table to, or to read it from when reversing.
+    -max-depth=0: How deeply objects and arrays of the JSON input may be nested. 0 means no limit.
+    -max-filter-output=0: The most output, in bytes, a single filter may produce. 0 means no limit.
+    -max-input=0: The largest JSON input accepted, in bytes. 0 means no limit.
+    -max-output=0: The most output, in bytes, all filters combined may produce for one document. 0 means no limit.
+    -no-cache=: A command whose results are never cached. Can be repeated.
     -output="": The output file to write to.
+    -patch=false: Print an RFC 6902 JSON Patch of the modifications instead of the filtered JSON.
     -pretty=false: Print JSON result with indentation. (shorthand)
     -pretty-print=false: Print JSON result with indentation.
+    -profile="": The profile of the filter file to apply. Its rules are merged over the top-level rules.
+    -sandbox=false: Run filter commands with an empty environment in the temporary directory. Implied by the other sandbox flags.
+    -sandbox-cpu=0s: The CPU time each sandboxed filter command may use. 0 means no limit.
+    -sandbox-dir="": The working directory of sandboxed filter commands.
+    -sandbox-env=: An environment variable passed to sandboxed filter commands, as NAME or NAME=value. Can be repeated.
+    -sandbox-exec=: An executable sandboxed filter commands may run, by name or absolute path. Can be repeated.
+    -sandbox-file-size=0: The largest file or output, in bytes, a sandboxed filter command may write. 0 means no limit.
+    -sandbox-memory=0: The memory, in bytes, each sandboxed filter command may use. 0 means no limit.
+    -seed="": Makes the fake built-in filters reproducible. Fake values are random when no seed is specified.
+    -secret-file="": The file containing the secret for keyed built-in filters. Defaults to $JSONFILTER_SECRET.
+    -scan="": Mask secrets and personal information in every string. A comma separated list of detectors or "all".
+    -schema="": A JSON Schema file the filtered JSON must be valid against. Nothing is written when it is not.
+    -report="": Print a coverage report instead of the filtered JSON. Either "json" or "table".
+    -strict=false: Fail when a rule in the filter file never matched a string value.
+    -trim="newline": How the output of filter commands is trimmed. One of newline (one trailing newline), space or none.
+    -watch=false: Filter again and print the whole new output whenever the input or filter file changes.
+
+With -watch the input and filter files are polled for changes and the JSON data is filtered
+again every time one of them changes. The whole new output is printed, not a diff against the
+previous one. Errors are printed and watching carries on. Piped input is read only once.
+
+The -max flags guard against huge or deeply nested input and against filters that produce too much
+output. Filtering fails with an error naming the limit as soon as one is exceeded, and the output of
+a filter command is never read beyond -max-filter-output.
+
+The sandbox flags restrict filter commands for filter files that come from other teams: commands
+run with an empty environment, in a fixed working directory, with CPU time, memory and file size
+limits, and only the executables listed with -sandbox-exec may run.
+
+With -schema the filtered JSON is validated against a JSON Schema before anything is written, and
+every value that does not satisfy the schema is reported with its path.
+
+The validate command type-checks each filter file and reports malformed or unreachable rules.
+
+The reverse command accepts the same flags as filtering and undoes a previous filtering with the
+same filter, i.e. "builtin:encrypt" rules decrypt and "builtin:pseudonymize" rules look up the
+original values in the mapping table.
+
+The proxy command runs a reverse proxy to the upstream URL that filters every JSON response body,
+and with -requests every JSON request body, using the filter flags above.
+
+The serve command runs an HTTP server that filters the JSON body of each POST /filter request with
+the ruleset named by the ruleset query parameter or the X-Ruleset header, or with -filter when none
+is named. It also serves /healthz and Prometheus metrics at /metrics, reloads filter files when they
+change and rejects bodies larger than -max-body-size.
 */
 package main
 
@@ -28,20 +89,79 @@ import (
   "fmt"
   "bufio"
   "encoding/json"
+  "time"
   jsonfilter "github.com/dschnare/jsonfilter/filter"
 )
 
 var (
   jsontext string
+  // The file jsontext was read from, if any.
+  inputFile string
+  // The schema read from the schema file, if any.
+  outputSchema *jsonfilter.Schema
   // Flags
   output string
   help bool
   filter string
   prettyPrint bool
+  patch bool
+  strict bool
+  report string
+  defaultAction string
+  scan string
+  secretFile string
+  mapping string
+  keyFile string
+  reverse bool
+  seed string
+  cacheSize int
+  cacheStats bool
+  noCache stringList
+  watch bool
+  profile string
+  schema string
+  trim string
+  inputNewline bool
+  sandbox bool
+  sandboxEnv stringList
+  sandboxDir string
+  sandboxExec stringList
+  sandboxCPU time.Duration
+  sandboxMemory uint64
+  sandboxFileSize uint64
+  maxInput int64
+  maxDepth int
+  maxFilterOutput int64
+  maxOutput int64
 )
 
+// stringList is a flag that can be repeated to collect several values.
+type stringList []string
+
+func (s *stringList) String() string {
+  return strings.Join(*s, ", ")
+}
+
+func (s *stringList) Set(value string) error {
+  *s = append(*s, value)
+  return nil
+}
+
+// commands maps each subcommand name to its implementation. Each implementation is passed
+// the arguments following the subcommand name and returns the process exit code.
+var commands = map[string]func(args []string) int{
+  "validate": validateCommand,
+  "reverse": reverseCommand,
+  "proxy": proxyCommand,
+  "serve": serveCommand,
+}
+
 func usage() {
   fmt.Fprintf(os.Stderr, "Usage: jsonfilter \"json to filter\" | jsonfilter [help|/?]\n")
+  fmt.Fprintf(os.Stderr, "       jsonfilter validate \"filter.json\" ...\n")
+  fmt.Fprintf(os.Stderr, "       jsonfilter reverse [flags] \"json to unfilter\"\n")
+  fmt.Fprintf(os.Stderr, "       jsonfilter proxy -listen :8080 -upstream URL [flags]\n")
+  fmt.Fprintf(os.Stderr, "       jsonfilter serve -listen :8080 [-ruleset name=filter.json ...] [flags]\n")
   flag.PrintDefaults()
 }
 
@@ -51,10 +171,20 @@ func init() {
     helpUsage = "Show the help message."
     outputDefault = ""
     outputUsage = "The output file to write to."
-    filterDefault = ""
-    filterUsage = "The filter(s) to apply to the strings contained in the JSON file."
     prettyPrintDefault = false
     prettyPrintUsage = "Print JSON result with indentation."
+    patchDefault = false
+    patchUsage = "Print an RFC 6902 JSON Patch of the modifications instead of the filtered JSON."
+    reportDefault = ""
+    reportUsage = "Print a coverage report instead of the filtered JSON. Either \"json\" or \"table\"."
+    mappingDefault = ""
+    mappingUsage = "The file to write the pseudonym mapping table to, or to read it from when reversing."
+    cacheStatsDefault = false
+    cacheStatsUsage = "Print cache hits, misses and evictions to stderr."
+    watchDefault = false
+    watchUsage = "Filter again and print the whole new output whenever the input or filter file changes."
+    schemaDefault = ""
+    schemaUsage = "A JSON Schema file the filtered JSON must be valid against. Nothing is written when it is not."
   )
 
   flag.Usage = usage
@@ -64,11 +194,110 @@ func init() {
   flag.BoolVar(&prettyPrint, "pretty-print", prettyPrintDefault, prettyPrintUsage)
   flag.BoolVar(&prettyPrint, "pretty", prettyPrintDefault, prettyPrintUsage + " (shorthand)")
 
-  flag.StringVar(&filter, "filter", filterDefault, filterUsage)
-
   flag.StringVar(&output, "output", outputDefault, outputUsage)
 
-  flag.Parse()
+  flag.BoolVar(&patch, "patch", patchDefault, patchUsage)
+
+  flag.StringVar(&report, "report", reportDefault, reportUsage)
+
+  flag.StringVar(&mapping, "mapping", mappingDefault, mappingUsage)
+
+  flag.BoolVar(&cacheStats, "cache-stats", cacheStatsDefault, cacheStatsUsage)
+
+  flag.BoolVar(&watch, "watch", watchDefault, watchUsage)
+
+  flag.StringVar(&schema, "schema", schemaDefault, schemaUsage)
+
+  defineFilterFlags(flag.CommandLine)
+}
+
+// defineFilterFlags defines the flags that configure how filters are applied on flags, so that
+// every subcommand that filters accepts them.
+func defineFilterFlags(flags *flag.FlagSet) {
+  const (
+    filterDefault = ""
+    filterUsage = "The filter(s) to apply to the strings contained in the JSON file."
+    strictDefault = false
+    strictUsage = "Fail when a rule in the filter file never matched a string value."
+    defaultActionDefault = "pass"
+    defaultActionUsage = "What to do with strings that no rule matched. One of pass, redact, delete or error."
+    scanDefault = ""
+    scanUsage = "Mask secrets and personal information in every string. A comma separated list of detectors or \"all\"."
+    secretFileDefault = ""
+    secretFileUsage = "The file containing the secret for keyed built-in filters. Defaults to $JSONFILTER_SECRET."
+    keyFileDefault = ""
+    keyFileUsage = "The file containing the key for the encryption built-in filters. Defaults to $JSONFILTER_KEY."
+    seedDefault = ""
+    seedUsage = "Makes the fake built-in filters reproducible. Fake values are random when no seed is specified."
+    cacheSizeDefault = 0
+    cacheSizeUsage = "Cache up to this many filter results keyed by command and value. 0 disables the cache."
+    noCacheUsage = "A command whose results are never cached. Can be repeated."
+    profileDefault = ""
+    profileUsage = "The profile of the filter file to apply. Its rules are merged over the top-level rules."
+    trimDefault = "newline"
+    trimUsage = "How the output of filter commands is trimmed. One of newline (one trailing newline), space or none."
+    inputNewlineDefault = false
+    inputNewlineUsage = "Append a newline to each value piped to a filter command."
+    sandboxDefault = false
+    sandboxUsage = "Run filter commands with an empty environment in the temporary directory. Implied by the other sandbox flags."
+    sandboxEnvUsage = "An environment variable passed to sandboxed filter commands, as NAME or NAME=value. Can be repeated."
+    sandboxDirDefault = ""
+    sandboxDirUsage = "The working directory of sandboxed filter commands."
+    sandboxExecUsage = "An executable sandboxed filter commands may run, by name or absolute path. Can be repeated."
+    sandboxCPUDefault = time.Duration(0)
+    sandboxCPUUsage = "The CPU time each sandboxed filter command may use. 0 means no limit."
+    sandboxMemoryDefault = uint64(0)
+    sandboxMemoryUsage = "The memory, in bytes, each sandboxed filter command may use. 0 means no limit."
+    sandboxFileSizeDefault = uint64(0)
+    sandboxFileSizeUsage = "The largest file or output, in bytes, a sandboxed filter command may write. 0 means no limit."
+    maxInputDefault = int64(0)
+    maxInputUsage = "The largest JSON input accepted, in bytes. 0 means no limit."
+    maxDepthDefault = 0
+    maxDepthUsage = "How deeply objects and arrays of the JSON input may be nested. 0 means no limit."
+    maxFilterOutputDefault = int64(0)
+    maxFilterOutputUsage = "The most output, in bytes, a single filter may produce. 0 means no limit."
+    maxOutputDefault = int64(0)
+    maxOutputUsage = "The most output, in bytes, all filters combined may produce for one document. 0 means no limit."
+  )
+
+  flags.StringVar(&filter, "filter", filterDefault, filterUsage)
+
+  flags.BoolVar(&strict, "strict", strictDefault, strictUsage)
+
+  flags.StringVar(&defaultAction, "default-action", defaultActionDefault, defaultActionUsage)
+
+  flags.StringVar(&scan, "scan", scanDefault, scanUsage)
+
+  flags.StringVar(&secretFile, "secret-file", secretFileDefault, secretFileUsage)
+
+  flags.StringVar(&keyFile, "key-file", keyFileDefault, keyFileUsage)
+
+  flags.StringVar(&seed, "seed", seedDefault, seedUsage)
+
+  flags.IntVar(&cacheSize, "cache", cacheSizeDefault, cacheSizeUsage)
+  flags.Var(&noCache, "no-cache", noCacheUsage)
+
+  flags.StringVar(&profile, "profile", profileDefault, profileUsage)
+
+  flags.StringVar(&trim, "trim", trimDefault, trimUsage)
+  flags.BoolVar(&inputNewline, "input-newline", inputNewlineDefault, inputNewlineUsage)
+
+  flags.BoolVar(&sandbox, "sandbox", sandboxDefault, sandboxUsage)
+  flags.Var(&sandboxEnv, "sandbox-env", sandboxEnvUsage)
+  flags.StringVar(&sandboxDir, "sandbox-dir", sandboxDirDefault, sandboxDirUsage)
+  flags.Var(&sandboxExec, "sandbox-exec", sandboxExecUsage)
+  flags.DurationVar(&sandboxCPU, "sandbox-cpu", sandboxCPUDefault, sandboxCPUUsage)
+  flags.Uint64Var(&sandboxMemory, "sandbox-memory", sandboxMemoryDefault, sandboxMemoryUsage)
+  flags.Uint64Var(&sandboxFileSize, "sandbox-file-size", sandboxFileSizeDefault, sandboxFileSizeUsage)
+
+  flags.Int64Var(&maxInput, "max-input", maxInputDefault, maxInputUsage)
+  flags.IntVar(&maxDepth, "max-depth", maxDepthDefault, maxDepthUsage)
+  flags.Int64Var(&maxFilterOutput, "max-filter-output", maxFilterOutputDefault, maxFilterOutputUsage)
+  flags.Int64Var(&maxOutput, "max-output", maxOutputDefault, maxOutputUsage)
+}
+
+func parseArgs(args []string) {
+  flag.CommandLine.Parse(args)
 
   if help {
     flag.Usage()
@@ -79,11 +308,12 @@ func init() {
   } else if len(flag.Args()) == 1 {
     jsontext = flag.Arg(0)
     if strings.HasSuffix(jsontext, ".json") {
+      inputFile = jsontext
       file,err := os.Open(jsontext)
       if err != nil {
         fmt.Printf("Failed to read from file :: %v\n", err.Error())
         os.Exit(1)
-      } else if jsontext,err = readFile(file); err != nil {
+      } else if jsontext,err = readFile(limits().Reader(file)); err != nil {
         fmt.Printf("Failed to read from file :: %v\n", err.Error())
         os.Exit(1)
       }
@@ -91,7 +321,7 @@ func init() {
   } else {
     if isPiped(os.Stdin) {
       var err error
-      if jsontext,err = readFile(os.Stdin); err != nil {
+      if jsontext,err = readFile(limits().Reader(os.Stdin)); err != nil {
         fmt.Printf("Failed to read from stdin :: %v\n", err.Error())
         os.Exit(1)
       }
@@ -106,24 +336,219 @@ func init() {
     flag.Usage()
     os.Exit(1)
   }
+
+  if report != "" && report != "json" && report != "table" {
+    fmt.Println("Expected report to be either \"json\" or \"table\".")
+    flag.Usage()
+    os.Exit(1)
+  }
 }
 
 func main() {
+  // Filter commands with resource limits are started through this executable.
+  jsonfilter.SandboxMain()
+
+  if len(os.Args) > 1 {
+    if command,ok := commands[os.Args[1]]; ok {
+      os.Exit(command(os.Args[2:]))
+    }
+  }
+
+  os.Exit(filterCommand(os.Args[1:]))
+}
+
+// filterCommand filters the JSON data specified by args and writes the result.
+// Returns the process exit code.
+func filterCommand(args []string) int {
+  parseArgs(args)
+
+  if err := loadSchema(); err != nil {
+    fmt.Fprintf(os.Stderr, "Failed to load schema :: %v\n", err.Error())
+    return 1
+  }
+
+  if watch {
+    return watchFilter()
+  }
+
+  if err := filterOnce(); err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err.Error())
+    return 1
+  }
+
+  return 0
+}
+
+// filterOnce filters the JSON data read by parseArgs and writes the result.
+func filterOnce() error {
   if len(jsontext) == 0 {
-    return
+    return nil
   }
 
-  if value,err := jsonfilter.FilterJsonFromText(jsontext, filter); err == nil {
-    if writer,err := createWriter(); err == nil {
-      if err := doWrite(writer, value); err != nil {
-        panic(err)
-      }
+  options,err := buildOptions()
+  if err != nil {
+    return err
+  }
+
+  value,ops,err := jsonfilter.PatchJsonFromTextWithOptions(jsontext, filter, options)
+
+  if options.Cache != nil && cacheStats {
+    stats := options.Cache.Stats()
+    fmt.Fprintf(os.Stderr, "Cache :: %d hits, %d misses, %d evictions, %d cached\n", stats.Hits, stats.Misses, stats.Evictions, stats.Len)
+  }
+
+  if err != nil {
+    return fmt.Errorf("Failed to filter JSON :: %v", err)
+  }
+
+  if outputSchema != nil {
+    if err = outputSchema.Validate(value); err != nil {
+      return fmt.Errorf("Filtered JSON does not match the schema :: %v", err)
+    }
+  }
+
+  if patch {
+    value = ops
+  } else if report == "json" {
+    value = options.Report
+  }
+  if options.Mapping != nil && !reverse {
+    if err := writeMapping(options.Mapping); err != nil {
+      return fmt.Errorf("Failed to write mapping :: %v", err)
+    }
+  }
+
+  writer,file,err := createWriter()
+  if err != nil {
+    return fmt.Errorf("Failed to create output :: %v", err)
+  }
+  if report == "table" {
+    err = options.Report.WriteTable(writer)
+    if err == nil {
+      err = writer.Flush()
+    }
+  } else {
+    err = doWrite(writer, value)
+  }
+  // With -watch the output file is created again on every change.
+  if file != nil {
+    if closeErr := file.Close(); err == nil {
+      err = closeErr
+    }
+  }
+  if err != nil {
+    return fmt.Errorf("Failed to write output :: %v", err)
+  }
+
+  return nil
+}
+
+// loadSchema reads the schema file the filtered JSON is validated against, if any.
+func loadSchema() (err error) {
+  if len(schema) > 0 {
+    outputSchema,err = jsonfilter.LoadSchema(schema)
+  }
+  return
+}
+
+// buildOptions converts the command line flags to filter options.
+func buildOptions() (jsonfilter.Options, error) {
+  options := jsonfilter.Options{Strict: strict, Reverse: reverse, Profile: profile, InputNewline: inputNewline, Limits: limits()}
+  if action,err := jsonfilter.ParseAction(defaultAction); err == nil {
+    options.DefaultAction = action
+  } else {
+    return options,err
+  }
+  if sandbox || len(sandboxEnv) > 0 || len(sandboxDir) > 0 || len(sandboxExec) > 0 || sandboxCPU > 0 || sandboxMemory > 0 || sandboxFileSize > 0 {
+    options.Sandbox = &jsonfilter.Sandbox{Env: sandboxEnv, Dir: sandboxDir, Executables: sandboxExec, CPUTime: sandboxCPU, Memory: sandboxMemory, FileSize: sandboxFileSize}
+  }
+  if policy,err := jsonfilter.ParseTrimPolicy(trim); err == nil {
+    options.Trim = policy
+  } else {
+    return options,err
+  }
+  if seed != "" {
+    options.Seed = []byte(seed)
+  }
+  if cacheSize > 0 {
+    options.Cache = jsonfilter.NewCache(cacheSize)
+    for _,command := range noCache {
+      options.Cache.Exclude(command)
+    }
+  }
+  if scan != "" {
+    options.Scan = strings.Split(scan, ",")
+  }
+  if report != "" {
+    options.Report = jsonfilter.NewReport()
+  }
+  if mapping != "" && reverse {
+    if m,err := readMapping(); err == nil {
+      options.Mapping = m
     } else {
-      panic(err)
+      return options,fmt.Errorf("Failed to read mapping :: %v", err)
     }
+  } else if mapping != "" {
+    options.Mapping = jsonfilter.NewMapping()
+  }
+  if secret,err := readSecret(secretFile, "JSONFILTER_SECRET"); err == nil {
+    options.Secret = secret
   } else {
-    panic(err)
+    return options,fmt.Errorf("Failed to read secret :: %v", err)
   }
+  if key,err := readSecret(keyFile, "JSONFILTER_KEY"); err == nil {
+    options.EncryptionKey = key
+  } else {
+    return options,fmt.Errorf("Failed to read encryption key :: %v", err)
+  }
+
+  return options,nil
+}
+
+// limits converts the limit flags to filter limits.
+func limits() jsonfilter.Limits {
+  return jsonfilter.Limits{Input: maxInput, Depth: maxDepth, FilterOutput: maxFilterOutput, Output: maxOutput}
+}
+
+// readSecret reads a secret from fileName or, when fileName is empty, from the environment
+// variable env. Surrounding whitespace is ignored.
+func readSecret(fileName string, env string) ([]byte, error) {
+  var text string
+
+  if len(fileName) > 0 {
+    if file,err := os.Open(fileName); err != nil {
+      return nil,err
+    } else {
+      defer file.Close()
+      if text,err = readFile(file); err != nil {
+        return nil,err
+      }
+    }
+  } else {
+    text = os.Getenv(env)
+  }
+
+  return []byte(strings.TrimSpace(text)),nil
+}
+
+func readMapping() (*jsonfilter.Mapping, error) {
+  if file,err := os.Open(mapping); err == nil {
+    defer file.Close()
+    return jsonfilter.ReadMapping(file)
+  } else {
+    return nil,err
+  }
+}
+
+func writeMapping(m *jsonfilter.Mapping) (err error) {
+  var file *os.File
+
+  if file,err = os.Create(mapping); err == nil {
+    defer file.Close()
+    _,err = m.WriteTo(file)
+  }
+
+  return
 }
 
 func isPiped(file *os.File) bool {
@@ -157,21 +582,19 @@ func doWrite(writer *bufio.Writer, value interface{}) (err error) {
   return
 }
 
-func createWriter() (*bufio.Writer, error) {
-  var writer *bufio.Writer
-
+// createWriter returns a writer for the output. The output file is returned too so that it can
+// be closed, and is nil when writing to stdout.
+func createWriter() (writer *bufio.Writer, file *os.File, err error) {
   if len(output) == 0 || isPiped(os.Stdout) {
     writer = bufio.NewWriter(os.Stdout)
-  } else if file,err := os.Create(output); err == nil {
+  } else if file,err = os.Create(output); err == nil {
     writer = bufio.NewWriter(file)
-  } else {
-    return nil,err
   }
 
-  return writer,nil
+  return
 }
 
-func readFile(file *os.File) (text string, err error) {
+func readFile(file io.Reader) (text string, err error) {
   var (
     buf bytes.Buffer
     c byte
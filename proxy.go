@@ -0,0 +1,80 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+  "flag"
+  "fmt"
+  "net/http"
+  "net/http/httputil"
+  "net/url"
+  "os"
+  jsonfilter "github.com/dschnare/jsonfilter/filter"
+)
+
+// proxyCommand runs a reverse proxy to an upstream URL that filters the JSON bodies passing
+// through it. Only returns when the proxy fails.
+func proxyCommand(args []string) int {
+  var (
+    listen string
+    upstream string
+    requests bool
+  )
+
+  flags := flag.NewFlagSet("proxy", flag.ExitOnError)
+  flags.Usage = func() {
+    fmt.Fprintf(os.Stderr, "Usage: jsonfilter proxy -listen :8080 -upstream URL [flags]\n")
+    flags.PrintDefaults()
+  }
+  flags.StringVar(&listen, "listen", ":8080", "The address to listen on.")
+  flags.StringVar(&upstream, "upstream", "", "The URL of the upstream server to proxy to.")
+  flags.BoolVar(&requests, "requests", false, "Also filter JSON request bodies before they reach the upstream server.")
+  defineFilterFlags(flags)
+  flags.Parse(args)
+
+  if len(upstream) == 0 || len(filter) == 0 {
+    fmt.Fprintln(os.Stderr, "Expected an upstream and a filter to be specified.")
+    flags.Usage()
+    return 1
+  }
+
+  target,err := url.Parse(upstream)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Invalid upstream :: %v\n", err.Error())
+    return 1
+  }
+
+  options,err := buildOptions()
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err.Error())
+    return 1
+  }
+
+  f,err := jsonfilter.Compile(filter, options)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Failed to load filter :: %v\n", err.Error())
+    return 1
+  }
+
+  proxy := httputil.NewSingleHostReverseProxy(target)
+  director := proxy.Director
+  proxy.Director = func (r *http.Request) {
+    director(r)
+    // Compressed responses cannot be filtered, so ask for them uncompressed.
+    r.Header.Del("Accept-Encoding")
+  }
+
+  handler := jsonfilter.Handler(proxy, f)
+  if requests {
+    handler = jsonfilter.RequestHandler(handler, f)
+  }
+
+  fmt.Fprintf(os.Stderr, "Proxying %s to %s\n", listen, target)
+  if err = http.ListenAndServe(listen, handler); err != nil {
+    fmt.Fprintf(os.Stderr, "Failed to serve :: %v\n", err.Error())
+  }
+
+  return 1
+}
@@ -0,0 +1,12 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+// reverseCommand undoes a previous filtering by applying the inverse of each built-in
+// filter found in the filter file. It accepts the same arguments as filtering.
+func reverseCommand(args []string) int {
+  reverse = true
+  return filterCommand(args)
+}
@@ -0,0 +1,281 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+  "errors"
+  "flag"
+  "fmt"
+  "io/ioutil"
+  "log"
+  "net/http"
+  "os"
+  "sort"
+  "strings"
+  "sync"
+  "time"
+  jsonfilter "github.com/dschnare/jsonfilter/filter"
+)
+
+const defaultRuleset = "default"
+
+// serveCommand runs an HTTP server that filters JSON documents posted to /filter with named
+// rulesets. Only returns when the server fails.
+func serveCommand(args []string) int {
+  var (
+    listen string
+    rulesets stringList
+    maxBodySize int64
+    reloadInterval time.Duration
+  )
+
+  flags := flag.NewFlagSet("serve", flag.ExitOnError)
+  flags.Usage = func() {
+    fmt.Fprintf(os.Stderr, "Usage: jsonfilter serve -listen :8080 [-filter \"filter.json\"] [-ruleset name=filter.json ...] [flags]\n")
+    flags.PrintDefaults()
+  }
+  flags.StringVar(&listen, "listen", ":8080", "The address to listen on.")
+  flags.Var(&rulesets, "ruleset", "A named ruleset as name=filter, selected with ?ruleset=name or the X-Ruleset header. Can be repeated.")
+  flags.Int64Var(&maxBodySize, "max-body-size", 10 << 20, "The largest request body accepted, in bytes.")
+  flags.DurationVar(&reloadInterval, "reload-interval", 2 * time.Second, "How often filter files are checked for changes. 0 disables reloading.")
+  defineFilterFlags(flags)
+  flags.Parse(args)
+
+  options,err := buildOptions()
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err.Error())
+    return 1
+  }
+
+  s := &server{options: options, maxBodySize: maxBodySize, rulesets: map[string]*ruleset{}, requests: map[string]int{}}
+  if len(filter) > 0 {
+    s.rulesets[defaultRuleset] = &ruleset{file: filter}
+  }
+  for _,arg := range rulesets {
+    name,file,ok := strings.Cut(arg, "=")
+    if !ok || len(name) == 0 || len(file) == 0 {
+      fmt.Fprintf(os.Stderr, "Expected a ruleset as name=filter got '%s'\n", arg)
+      return 1
+    }
+    s.rulesets[name] = &ruleset{file: file}
+  }
+
+  if len(s.rulesets) == 0 {
+    fmt.Fprintln(os.Stderr, "Expected a filter or a ruleset to be specified.")
+    flags.Usage()
+    return 1
+  }
+  if err := s.reload(); err != nil {
+    fmt.Fprintf(os.Stderr, "Failed to load filter :: %v\n", err.Error())
+    return 1
+  }
+
+  if reloadInterval > 0 {
+    go func() {
+      for range time.Tick(reloadInterval) {
+        if err := s.reload(); err != nil {
+          log.Printf("Failed to reload filter :: %v", err)
+        }
+      }
+    }()
+  }
+
+  mux := http.NewServeMux()
+  mux.HandleFunc("/filter", s.serveFilter)
+  mux.HandleFunc("/healthz", s.serveHealth)
+  mux.HandleFunc("/metrics", s.serveMetrics)
+
+  fmt.Fprintf(os.Stderr, "Serving on %s\n", listen)
+  if err := http.ListenAndServe(listen, mux); err != nil {
+    fmt.Fprintf(os.Stderr, "Failed to serve :: %v\n", err.Error())
+  }
+
+  return 1
+}
+
+// ruleset is a named filter. File filters are compiled again whenever the file or a file it
+// includes changes. Version fingerprints those files, see modTimes.
+type ruleset struct {
+  file string
+  filter *jsonfilter.Filter
+  version string
+}
+
+type server struct {
+  mutex sync.RWMutex
+  options jsonfilter.Options
+  maxBodySize int64
+  rulesets map[string]*ruleset
+  // Metrics
+  requests map[string]int
+  bytesIn int64
+  bytesOut int64
+  reloads int
+  reloadErrors int
+}
+
+// reload compiles every ruleset whose filter file changed since it was last checked. A ruleset
+// that fails to compile keeps its previous filter. Returns the first error encountered.
+func (s *server) reload() (err error) {
+  s.mutex.RLock()
+  names := make([]string, 0, len(s.rulesets))
+  for name := range s.rulesets {
+    names = append(names, name)
+  }
+  s.mutex.RUnlock()
+  sort.Strings(names)
+
+  for _,name := range names {
+    s.mutex.RLock()
+    r := *s.rulesets[name]
+    s.mutex.RUnlock()
+
+    version := ""
+    if strings.HasSuffix(r.file, ".json") {
+      files,_ := jsonfilter.Includes(r.file)
+      if len(files) == 0 {
+        files = []string{r.file}
+      }
+      version = modTimes(files)
+    }
+
+    if r.filter != nil && version == r.version {
+      continue
+    }
+
+    if f,compileErr := jsonfilter.Compile(r.file, s.options); compileErr == nil {
+      s.mutex.Lock()
+      s.rulesets[name] = &ruleset{file: r.file, filter: f, version: version}
+      if r.filter != nil {
+        s.reloads++
+      }
+      s.mutex.Unlock()
+    } else {
+      if err == nil {
+        err = fmt.Errorf("Ruleset '%s' :: %v", name, compileErr)
+      }
+      // Remember the broken file so it is only compiled again once it changes.
+      s.mutex.Lock()
+      s.rulesets[name] = &ruleset{file: r.file, filter: r.filter, version: version}
+      s.reloadErrors++
+      s.mutex.Unlock()
+    }
+  }
+
+  return
+}
+
+func (s *server) serveFilter(w http.ResponseWriter, r *http.Request) {
+  name := r.URL.Query().Get("ruleset")
+  if len(name) == 0 {
+    name = r.Header.Get("X-Ruleset")
+  }
+  if len(name) == 0 {
+    name = defaultRuleset
+  }
+
+  status,body := s.filterRequest(w, r, name)
+
+  s.mutex.Lock()
+  if _,ok := s.rulesets[name]; !ok {
+    // Unknown names come from clients and are not used as metric labels, whatever the status.
+    name = ""
+  }
+  s.requests[fmt.Sprintf("%s\x00%d", name, status)]++
+  s.bytesOut += int64(len(body))
+  s.mutex.Unlock()
+
+  if status == http.StatusOK {
+    w.Header().Set("Content-Type", "application/json")
+  } else {
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+  }
+  w.WriteHeader(status)
+  w.Write(body)
+}
+
+// filterRequest filters the body of a request with the named ruleset and returns the
+// response status and body.
+func (s *server) filterRequest(w http.ResponseWriter, r *http.Request, name string) (int, []byte) {
+  if r.Method != http.MethodPost {
+    w.Header().Set("Allow", http.MethodPost)
+    return http.StatusMethodNotAllowed,[]byte("Expected a POST request\n")
+  }
+
+  s.mutex.RLock()
+  rs,ok := s.rulesets[name]
+  s.mutex.RUnlock()
+  if !ok {
+    return http.StatusNotFound,[]byte(fmt.Sprintf("Unknown ruleset '%s'\n", name))
+  }
+
+  data,err := ioutil.ReadAll(s.options.Limits.Reader(http.MaxBytesReader(w, r.Body, s.maxBodySize)))
+  s.mutex.Lock()
+  s.bytesIn += int64(len(data))
+  s.mutex.Unlock()
+
+  var (
+    tooLarge *http.MaxBytesError
+    limitErr *jsonfilter.LimitError
+  )
+  if errors.As(err, &tooLarge) {
+    return http.StatusRequestEntityTooLarge,[]byte(fmt.Sprintf("Expected a body of at most %d bytes\n", s.maxBodySize))
+  } else if errors.As(err, &limitErr) {
+    return http.StatusRequestEntityTooLarge,[]byte(fmt.Sprintf("Failed to read body :: %v\n", err))
+  } else if err != nil {
+    return http.StatusBadRequest,[]byte(fmt.Sprintf("Failed to read body :: %v\n", err))
+  }
+
+  if data,err = rs.filter.Bytes(data); errors.As(err, &limitErr) {
+    return http.StatusRequestEntityTooLarge,[]byte(fmt.Sprintf("Failed to filter JSON :: %v\n", err))
+  } else if err != nil {
+    return http.StatusUnprocessableEntity,[]byte(fmt.Sprintf("Failed to filter JSON :: %v\n", err))
+  }
+
+  return http.StatusOK,data
+}
+
+func (s *server) serveHealth(w http.ResponseWriter, r *http.Request) {
+  w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+  fmt.Fprintln(w, "ok")
+}
+
+// serveMetrics writes the server metrics in the Prometheus text exposition format.
+func (s *server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+  s.mutex.RLock()
+  defer s.mutex.RUnlock()
+
+  w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+  fmt.Fprintln(w, "# TYPE jsonfilter_requests_total counter")
+  keys := make([]string, 0, len(s.requests))
+  for key := range s.requests {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  for _,key := range keys {
+    name,status,_ := strings.Cut(key, "\x00")
+    fmt.Fprintf(w, "jsonfilter_requests_total{ruleset=%q,status=\"%s\"} %d\n", name, status, s.requests[key])
+  }
+
+  fmt.Fprintln(w, "# TYPE jsonfilter_request_bytes_total counter")
+  fmt.Fprintf(w, "jsonfilter_request_bytes_total %d\n", s.bytesIn)
+  fmt.Fprintln(w, "# TYPE jsonfilter_response_bytes_total counter")
+  fmt.Fprintf(w, "jsonfilter_response_bytes_total %d\n", s.bytesOut)
+  fmt.Fprintln(w, "# TYPE jsonfilter_reloads_total counter")
+  fmt.Fprintf(w, "jsonfilter_reloads_total %d\n", s.reloads)
+  fmt.Fprintln(w, "# TYPE jsonfilter_reload_errors_total counter")
+  fmt.Fprintf(w, "jsonfilter_reload_errors_total %d\n", s.reloadErrors)
+  fmt.Fprintln(w, "# TYPE jsonfilter_rulesets gauge")
+  fmt.Fprintf(w, "jsonfilter_rulesets %d\n", len(s.rulesets))
+
+  if s.options.Cache != nil {
+    stats := s.options.Cache.Stats()
+    fmt.Fprintln(w, "# TYPE jsonfilter_cache_hits_total counter")
+    fmt.Fprintf(w, "jsonfilter_cache_hits_total %d\n", stats.Hits)
+    fmt.Fprintln(w, "# TYPE jsonfilter_cache_misses_total counter")
+    fmt.Fprintf(w, "jsonfilter_cache_misses_total %d\n", stats.Misses)
+  }
+}
@@ -0,0 +1,40 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+  "flag"
+  "fmt"
+  "os"
+  jsonfilter "github.com/dschnare/jsonfilter/filter"
+)
+
+// validateCommand type-checks each filter file passed as an argument and prints
+// every malformed or unreachable rule found. Exits with 1 if any filter is invalid.
+func validateCommand(args []string) int {
+  flags := flag.NewFlagSet("validate", flag.ExitOnError)
+  flags.Usage = func() {
+    fmt.Fprintf(os.Stderr, "Usage: jsonfilter validate \"filter.json\" ...\n")
+    flags.PrintDefaults()
+  }
+  flags.Parse(args)
+
+  if flags.NArg() == 0 {
+    flags.Usage()
+    return 1
+  }
+
+  status := 0
+  for _,filter := range flags.Args() {
+    if err := jsonfilter.Validate(filter); err == nil {
+      fmt.Printf("%s :: ok\n", filter)
+    } else {
+      fmt.Printf("%s :: invalid\n%v\n", filter, err.Error())
+      status = 1
+    }
+  }
+
+  return status
+}
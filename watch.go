@@ -0,0 +1,94 @@
+// Copyright 2014 Darren Schnare. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+  "fmt"
+  "os"
+  "strings"
+  "time"
+  jsonfilter "github.com/dschnare/jsonfilter/filter"
+)
+
+// watchInterval is how often watched files are polled for changes.
+const watchInterval = 500 * time.Millisecond
+
+// watchFilter filters the JSON data, then polls the input and filter files and filters again
+// every time one of them changes. Errors are printed and watching carries on, so an invalid edit
+// can be fixed. Piped input is read only once. Never returns.
+func watchFilter() int {
+  last := modTimes(watchedFiles())
+  if err := filterOnce(); err != nil {
+    fmt.Fprintf(os.Stderr, "%v\n", err.Error())
+  }
+
+  for {
+    time.Sleep(watchInterval)
+
+    // The included files can change too, so they are listed again every time.
+    current := modTimes(watchedFiles())
+    if current == last {
+      continue
+    }
+    last = current
+
+    if len(inputFile) > 0 {
+      if file,err := os.Open(inputFile); err == nil {
+        jsontext,err = readFile(limits().Reader(file))
+        file.Close()
+        if err != nil {
+          fmt.Fprintf(os.Stderr, "Failed to read from file :: %v\n", err.Error())
+          continue
+        }
+      } else {
+        fmt.Fprintf(os.Stderr, "Failed to read from file :: %v\n", err.Error())
+        continue
+      }
+    }
+
+    // The schema file is watched too, so it is read again.
+    if err := loadSchema(); err != nil {
+      fmt.Fprintf(os.Stderr, "Failed to load schema :: %v\n", err.Error())
+      continue
+    }
+
+    fmt.Fprintf(os.Stderr, "--- %s changed, filtering again\n", time.Now().Format("15:04:05"))
+    if err := filterOnce(); err != nil {
+      fmt.Fprintf(os.Stderr, "%v\n", err.Error())
+    }
+  }
+}
+
+// watchedFiles returns the files that affect the output of filtering, including the schema file
+// and every filter file included by the filter file.
+func watchedFiles() []string {
+  files := []string{}
+  if len(inputFile) > 0 {
+    files = append(files, inputFile)
+  }
+  if len(schema) > 0 {
+    files = append(files, schema)
+  }
+  if includes,err := jsonfilter.Includes(filter); err == nil {
+    files = append(files, includes...)
+  } else if strings.HasSuffix(filter, ".json") {
+    files = append(files, filter)
+  }
+  return files
+}
+
+// modTimes returns a fingerprint of the modification time and size of every file. Missing
+// files are part of the fingerprint too, so deleting and recreating a file is noticed.
+func modTimes(files []string) string {
+  var b strings.Builder
+  for _,file := range files {
+    if info,err := os.Stat(file); err == nil {
+      fmt.Fprintf(&b, "%s:%d:%d;", file, info.ModTime().UnixNano(), info.Size())
+    } else {
+      fmt.Fprintf(&b, "%s:missing;", file)
+    }
+  }
+  return b.String()
+}